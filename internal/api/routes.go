@@ -1,64 +1,191 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/blobs"
 	"multi-upload-api/internal/config"
 	"multi-upload-api/internal/handlers"
 	"multi-upload-api/internal/middleware"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/processing"
 	"multi-upload-api/internal/repository"
 	"multi-upload-api/internal/services"
+	"multi-upload-api/internal/storage"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
+func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config, store storage.Backend) {
 	// Inicializar serviços
 	jwtService := auth.NewJWTService(cfg.JWTSecret)
+	urlSigner := auth.NewURLSigner(cfg.URLSigningSecret)
 	emailService := services.NewEmailService(cfg)
 
 	// Inicializar repositórios
 	userRepo := repository.NewUserRepository(db)
 	mediaRepo := repository.NewMediaRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	albumRepo := repository.NewAlbumRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+
+	// Arquivos originais endereçados por conteúdo (SHA-256)
+	blobStore := blobs.NewStore(store, blobRepo)
+
+	// Processamento de mídia em segundo plano
+	steps := []processing.Step{
+		processing.NewImageVariantStep(store, mediaRepo, cfg.ImageVariantWidths, cfg.ImageVariantFormats, cfg.ImageVariantQuality),
+	}
+	if cfg.VideoProcessing {
+		steps = append(steps, processing.NewVideoProbeStep(store, mediaRepo, processing.CommandExecutor{}, cfg.FFprobePath, cfg.FFmpegPath))
+
+		// O empacotamento HLS usa a resolução extraída pela etapa anterior
+		if cfg.HLSPackaging {
+			steps = append(steps, processing.NewHLSStep(store, mediaRepo, processing.CommandExecutor{}, cfg.FFmpegPath, cfg.HLSRenditions, cfg.HLSSegmentSeconds))
+		}
+	}
+	processor := processing.NewWorker(mediaRepo, cfg.ProcessingWorkers, steps...)
+	processor.Start(context.Background())
+
+	// Exclusão definitiva das mídias que venceram na lixeira
+	purger := processing.NewTrashPurger(store, mediaRepo, time.Duration(cfg.TrashRetentionDays)*24*time.Hour)
+	purger.Start(context.Background())
+
+	// Descarte dos uploads resumíveis abandonados
+	tusDir := filepath.Join(cfg.UploadPath, ".tus")
+	sweeper := processing.NewUploadSweeper(uploadRepo, tusDir, cfg.TusUploadTTL)
+	sweeper.Start(context.Background())
 
 	// Inicializar handlers
-	authHandler := handlers.NewAuthHandler(userRepo, jwtService)
-	mediaHandler := handlers.NewMediaHandler(mediaRepo, cfg.UploadPath)
+	authHandler := handlers.NewAuthHandler(userRepo, tokenRepo, mfaRepo, jwtService, cfg)
+	mediaHandler := handlers.NewMediaHandler(mediaRepo, userRepo, store, blobStore, urlSigner, processor, cfg)
 	contactHandler := handlers.NewContactHandler(emailService)
+	tusHandler := handlers.NewTusHandler(uploadRepo, mediaHandler, tusDir, cfg.TusUploadTTL)
+	albumHandler := handlers.NewAlbumHandler(albumRepo, mediaRepo)
+	userHandler := handlers.NewUserHandler(userRepo, mediaRepo, tokenRepo)
+	passwordHandler := handlers.NewPasswordHandler(userRepo, tokenRepo, emailService, cfg)
+	mfaHandler := handlers.NewMFAHandler(userRepo, mfaRepo, tokenRepo, cfg)
+
+	// Papéis: viewer consulta, editor também altera mídias e álbuns, admin
+	// também gerencia usuários
+	editor := middleware.RequireRole(models.RoleEditor)
+	admin := middleware.RequireRole(models.RoleAdmin)
+
+	// Usuários que ainda precisam configurar a autenticação em dois fatores
+	// exigida para o seu papel só acessam /me, /logout e /me/mfa
+	mfaSetup := middleware.RequireMFASetup()
 
 	// Rotas públicas
 	public := router.Group("/api/v1")
 	{
 		// Autenticação
 		public.POST("/login", authHandler.Login)
+		public.POST("/login/mfa", authHandler.VerifyMFA)
+		public.POST("/refresh", authHandler.Refresh)
+
+		// Recuperação de senha
+		public.POST("/password/forgot", passwordHandler.Forgot)
+		public.POST("/password/reset", passwordHandler.Reset)
 
 		// Contato
 		public.POST("/contact", contactHandler.SendContact)
 
-		// Servir arquivos (público para visualização)
-		public.GET("/files/*filepath", mediaHandler.Serve)
+		// Servir arquivos (público para visualização; mídias privadas apenas para o dono)
+		public.GET("/files/*filepath", middleware.OptionalAuth(jwtService, tokenRepo), mediaHandler.Serve)
+
+		// Playlist master HLS de um vídeo (mesmas regras de acesso dos arquivos)
+		public.GET("/media/:id/stream.m3u8", middleware.OptionalAuth(jwtService, tokenRepo), mediaHandler.Stream)
+
+		// Tipos e tamanhos aceitos nos uploads
+		public.GET("/upload-policy", mediaHandler.UploadPolicy)
 
 		// Galeria pública de mídias
 		public.GET("/gallery", mediaHandler.ListPublic)
+		public.GET("/gallery/albums/:slug", albumHandler.GetPublic)
+
+		// Descoberta do protocolo tus (uploads resumíveis)
+		public.OPTIONS("/media/uploads", tusHandler.Options)
 	}
 
 	// Rotas protegidas
 	protected := router.Group("/api/v1")
-	protected.Use(middleware.AuthMiddleware(jwtService))
+	protected.Use(middleware.AuthMiddleware(jwtService, tokenRepo))
 	{
 		// Usuário
 		protected.GET("/me", authHandler.Me)
+		protected.POST("/logout", authHandler.Logout)
+		protected.GET("/me/usage", mfaSetup, mediaHandler.Usage)
+
+		// Autenticação em dois fatores
+		mfa := protected.Group("/me/mfa")
+		{
+			mfa.GET("", mfaHandler.Status)
+			mfa.POST("/setup", mfaHandler.Setup)
+			mfa.POST("/enable", mfaHandler.Enable)
+			mfa.POST("/disable", mfaHandler.Disable)
+			mfa.POST("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		}
 
 		// Mídia
-		media := protected.Group("/media")
+		media := protected.Group("/media", mfaSetup)
 		{
-			media.POST("/upload", mediaHandler.Upload)
+			media.POST("/upload", editor, mediaHandler.Upload)
 			media.GET("", mediaHandler.List)
+			media.GET("/trash", mediaHandler.ListTrash)
 			media.GET("/:id", mediaHandler.Get)
-			media.PUT("/:id", mediaHandler.Update)
-			media.PUT("/:id/replace", mediaHandler.Replace)
-			media.DELETE("/:id", mediaHandler.Delete)
-			media.POST("/sort", mediaHandler.UpdateSortOrder)
+			media.PUT("/:id", editor, mediaHandler.Update)
+			media.PUT("/:id/replace", editor, mediaHandler.Replace)
+			media.POST("/:id/link", mediaHandler.Link)
+			media.GET("/:id/versions", mediaHandler.ListVersions)
+			media.POST("/:id/versions/:versionId/restore", editor, mediaHandler.RestoreVersion)
+			media.DELETE("/:id", editor, mediaHandler.Delete)
+			media.POST("/:id/restore", editor, mediaHandler.Restore)
+			media.POST("/sort", editor, mediaHandler.UpdateSortOrder)
+
+			// Uploads resumíveis (tus 1.0)
+			media.POST("/uploads", editor, tusHandler.Create)
+			media.HEAD("/uploads/:uploadId", editor, tusHandler.Head)
+			media.PATCH("/uploads/:uploadId", editor, tusHandler.Patch)
+			media.DELETE("/uploads/:uploadId", editor, tusHandler.Delete)
+		}
+
+		// Álbuns
+		albums := protected.Group("/albums", mfaSetup)
+		{
+			albums.POST("", editor, albumHandler.Create)
+			albums.GET("", albumHandler.List)
+			albums.GET("/:id", albumHandler.Get)
+			albums.PUT("/:id", editor, albumHandler.Update)
+			albums.DELETE("/:id", editor, albumHandler.Delete)
+			albums.POST("/:id/media", editor, albumHandler.AddMedia)
+			albums.DELETE("/:id/media/:mediaId", editor, albumHandler.RemoveMedia)
+			albums.POST("/:id/sort", editor, albumHandler.UpdateSortOrder)
+		}
+
+		// Usuários (apenas administradores)
+		users := protected.Group("/users", mfaSetup, admin)
+		{
+			users.GET("", userHandler.List)
+			users.POST("", userHandler.Create)
+			users.GET("/:id", userHandler.Get)
+			users.PUT("/:id", userHandler.Update)
+			users.DELETE("/:id", userHandler.Delete)
+			users.POST("/:id/disable", userHandler.Disable)
+			users.POST("/:id/enable", userHandler.Enable)
+			users.POST("/:id/password", userHandler.ResetPassword)
+			users.DELETE("/:id/mfa", mfaHandler.ResetUser)
+		}
+
+		// Configurações (apenas administradores)
+		settings := protected.Group("/settings", mfaSetup, admin)
+		{
+			settings.GET("/mfa", mfaHandler.GetPolicy)
+			settings.PUT("/mfa", mfaHandler.UpdatePolicy)
 		}
 	}
 
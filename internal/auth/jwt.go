@@ -9,8 +9,15 @@ import (
 )
 
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID   int         `json:"user_id"`
+	Username string      `json:"username"`
+	Role     models.Role `json:"role"`
+	// SessionID identifica a sessão (família de refresh tokens) que emitiu o
+	// token. O jti (RegisteredClaims.ID) é usado na revogação.
+	SessionID string `json:"sid"`
+	// MFASetupRequired indica que o usuário precisa configurar a
+	// autenticação em dois fatores, exigida para o seu papel
+	MFASetupRequired bool `json:"mfa_setup_required,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -24,13 +31,18 @@ func NewJWTService(secretKey string) *JWTService {
 	}
 }
 
-// GenerateToken gera um token JWT para o usuário
-func (j *JWTService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken gera um access token para o usuário, com o jti e a
+// expiração informados, vinculado à sessão sessionID
+func (j *JWTService) GenerateToken(user *models.User, sessionID, tokenID string, expiresAt time.Time, mfaSetupRequired bool) (string, error) {
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:           user.ID,
+		Username:         user.Username,
+		Role:             user.Role,
+		SessionID:        sessionID,
+		MFASetupRequired: mfaSetupRequired,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * 24 * time.Hour)), // 15 dias
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -53,7 +65,9 @@ func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	// Tokens sem jti (emitidos antes da revogação existir) não podem ser
+	// revogados e por isso não são aceitos
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.ID != "" {
 		return claims, nil
 	}
 
@@ -0,0 +1,12 @@
+package auth
+
+// GeneratePasswordResetToken gera um token de redefinição de senha, no mesmo
+// formato dos refresh tokens: 256 bits aleatórios, armazenados como SHA-256
+func GeneratePasswordResetToken() (token string, hash string, err error) {
+	return GenerateRefreshToken()
+}
+
+// HashPasswordResetToken retorna o hash armazenado de um token de redefinição
+func HashPasswordResetToken(token string) string {
+	return HashRefreshToken(token)
+}
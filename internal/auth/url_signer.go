@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Parâmetros de query de uma URL assinada
+const (
+	ParamExpires   = "expires"
+	ParamBind      = "bind"
+	ParamSignature = "signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("assinatura inválida")
+	ErrSignatureExpired = errors.New("link expirado")
+)
+
+// URLSigner gera e valida URLs assinadas com HMAC-SHA256, que dão acesso
+// temporário a um arquivo sem o header Authorization (ex.: em uma tag <img>)
+type URLSigner struct {
+	secretKey []byte
+}
+
+func NewURLSigner(secretKey string) *URLSigner {
+	// Derivar uma chave própria, para que o segredo não seja usado
+	// diretamente em dois esquemas de assinatura (JWT e URLs)
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte("signed-urls"))
+	return &URLSigner{secretKey: mac.Sum(nil)}
+}
+
+// Sign retorna os parâmetros de query que autorizam o acesso à chave até
+// expiresAt. Com ip informado, a URL só é aceita quando vem desse endereço.
+func (s *URLSigner) Sign(key string, expiresAt time.Time, ip string) url.Values {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set(ParamExpires, expires)
+	if ip != "" {
+		query.Set(ParamBind, "ip")
+	}
+	query.Set(ParamSignature, s.signature(key, expires, ip))
+	return query
+}
+
+// Verify confere a assinatura da chave nos parâmetros da URL
+func (s *URLSigner) Verify(key string, query url.Values, clientIP string, now time.Time) error {
+	expires := query.Get(ParamExpires)
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	ip := ""
+	if query.Get(ParamBind) == "ip" {
+		ip = clientIP
+	}
+
+	expected := s.signature(key, expires, ip)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(ParamSignature))) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > expiresAt {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// SignatureExpiry retorna o vencimento informado nos parâmetros de uma URL
+// assinada, ou o instante zero se ele não puder ser lido. Não confere a
+// assinatura: use depois de Verify.
+func SignatureExpiry(query url.Values) time.Time {
+	expiresAt, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(expiresAt, 0)
+}
+
+func (s *URLSigner) signature(key, expires, ip string) string {
+	mac := hmac.New(sha256.New, s.secretKey)
+	mac.Write([]byte(key + "\n" + expires + "\n" + ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,119 @@
+package blobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"path"
+
+	"github.com/google/uuid"
+)
+
+// stagingPrefix é onde os arquivos ficam enquanto são recebidos, antes de o
+// SHA-256 do conteúdo ser conhecido
+const stagingPrefix = "tmp"
+
+// Object descreve um conteúdo gravado no armazenamento
+type Object struct {
+	Key      string
+	Checksum string
+	Size     int64
+}
+
+// Store grava os arquivos de mídia em layout endereçado por conteúdo
+// (blobs/ab/cd/<sha256>): conteúdos idênticos são armazenados uma única vez e
+// removidos apenas quando a última referência é liberada.
+type Store struct {
+	storage  storage.Backend
+	blobRepo *repository.BlobRepository
+}
+
+func NewStore(store storage.Backend, blobRepo *repository.BlobRepository) *Store {
+	return &Store{
+		storage:  store,
+		blobRepo: blobRepo,
+	}
+}
+
+// Put grava o conteúdo de r e registra uma referência ao blob. O SHA-256 é
+// calculado durante a gravação, em uma chave temporária; ao final o arquivo
+// é movido para a chave do blob ou descartado, se o conteúdo já existir.
+// Quando r permite voltar ao início (arquivos já completos em disco, como os
+// do tus), o SHA-256 é calculado antes e o conteúdo é gravado diretamente na
+// chave do blob, sem a cópia da chave temporária, e apenas se ainda não existir.
+func (s *Store) Put(ctx context.Context, r io.Reader, size int64, contentType string) (*Object, error) {
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		return s.putSeeker(ctx, seeker, contentType)
+	}
+
+	staging := path.Join(stagingPrefix, uuid.New().String())
+
+	digest := storage.NewDigestReader(r)
+	if err := s.storage.Put(ctx, staging, digest, size, contentType); err != nil {
+		s.storage.Delete(context.Background(), staging)
+		return nil, err
+	}
+
+	object := &Object{
+		Key:      storage.BlobKey(digest.SHA256()),
+		Checksum: digest.SHA256(),
+		Size:     digest.Size(),
+	}
+
+	err := s.blobRepo.Acquire(object.Checksum, object.Key, object.Size, func(created bool) error {
+		if created {
+			return s.storage.Move(ctx, staging, object.Key)
+		}
+		return s.storage.Delete(ctx, staging)
+	})
+	if err != nil {
+		s.storage.Delete(context.Background(), staging)
+		return nil, fmt.Errorf("erro ao registrar conteúdo: %w", err)
+	}
+
+	return object, nil
+}
+
+// putSeeker lê o conteúdo uma vez para calcular o SHA-256 e só o grava, já
+// na chave do blob, se ele ainda não estiver armazenado
+func (s *Store) putSeeker(ctx context.Context, r io.ReadSeeker, contentType string) (*Object, error) {
+	digest := storage.NewDigestReader(r)
+	if _, err := io.Copy(io.Discard, digest); err != nil {
+		return nil, err
+	}
+
+	object := &Object{
+		Key:      storage.BlobKey(digest.SHA256()),
+		Checksum: digest.SHA256(),
+		Size:     digest.Size(),
+	}
+
+	err := s.blobRepo.Acquire(object.Checksum, object.Key, object.Size, func(created bool) error {
+		if !created {
+			return nil
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return s.storage.Put(ctx, object.Key, r, object.Size, contentType)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao registrar conteúdo: %w", err)
+	}
+
+	return object, nil
+}
+
+// Release libera uma referência ao arquivo. Arquivos sem checksum, gravados
+// antes do armazenamento por conteúdo, são excluídos diretamente.
+func (s *Store) Release(ctx context.Context, key string, checksum *string) error {
+	if checksum == nil || *checksum == "" {
+		return s.storage.Delete(ctx, key)
+	}
+
+	return s.blobRepo.Release(*checksum, func(blobKey string) error {
+		return s.storage.Delete(ctx, blobKey)
+	})
+}
@@ -2,7 +2,12 @@ package config
 
 import (
 	"fmt"
+	"multi-upload-api/internal/models"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -22,10 +27,94 @@ type Config struct {
 	ContactEmail string
 	FromEmail    string
 	FromName     string
+
+	// Validade dos access tokens (curta) e dos refresh tokens
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Recuperação de senha: validade do token enviado por e-mail, página do
+	// frontend que recebe o token (vazio: o e-mail traz apenas o token) e
+	// intervalo mínimo entre dois envios para o mesmo usuário
+	PasswordResetTTL      time.Duration
+	PasswordResetURL      string
+	PasswordResetCooldown time.Duration
+
+	// Autenticação em dois fatores: emissor exibido no aplicativo
+	// autenticador e validade do desafio da segunda etapa do login
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	// Armazenamento de arquivos ("local" ou "s3")
+	StorageDriver  string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool
+
+	// Tipos MIME aceitos no upload, detectados pelo conteúdo do arquivo
+	AllowedImageTypes []string
+	AllowedVideoTypes []string
+
+	// URLs assinadas para arquivos privados: segredo (padrão: JWT_SECRET),
+	// validade padrão e máxima
+	URLSigningSecret string
+	SignedURLTTL     time.Duration
+	SignedURLMaxTTL  time.Duration
+
+	// Tamanho máximo de cada arquivo, por tipo de mídia (0 significa sem limite)
+	MaxImageSize int64
+	MaxVideoSize int64
+
+	// Visibilidade aplicada quando o upload não informa uma (private, unlisted
+	// ou public). O padrão é private: nada fica visível sem uma escolha explícita.
+	DefaultVisibility string
+
+	// Rejeitar uploads cujo conteúdo o usuário já enviou (pode ser alterado por upload)
+	RejectDuplicates bool
+
+	// Cota padrão de cada usuário, usada quando o usuário não tem uma cota
+	// própria (0 significa sem limite)
+	DefaultQuotaBytes int64
+	DefaultQuotaFiles int
+
+	// Quantidade de versões anteriores mantidas por mídia ao substituir o arquivo (0 desativa o histórico)
+	MediaVersionRetention int
+
+	// Dias que uma mídia excluída fica na lixeira antes de ser removida definitivamente
+	TrashRetentionDays int
+
+	// Tempo sem receber dados após o qual um upload resumível expira e é descartado
+	TusUploadTTL time.Duration
+
+	// Processamento de mídia em segundo plano. Os formatos das variantes são
+	// normalizados (jpg vira jpeg) e só jpeg e png são aceitos.
+	ProcessingWorkers   int
+	ImageVariantWidths  []int
+	ImageVariantFormats []string
+	ImageVariantQuality int
+	VideoProcessing     bool
+	FFprobePath         string
+	FFmpegPath          string
+
+	// Empacotamento HLS dos vídeos: alturas das rendições e duração dos segmentos em segundos
+	HLSPackaging      bool
+	HLSRenditions     []int
+	HLSSegmentSeconds int
+
+	// invalidEnv são as variáveis numéricas que não puderam ser lidas
+	invalidEnv []string
 }
 
+// invalidEnv acumula, durante Load, as variáveis de tamanho e de limite com
+// valores que não puderam ser interpretados: o padrão é usado no lugar delas,
+// e Validate as informa para que o erro não passe despercebido
+var invalidEnv []string
+
 func Load() *Config {
-	return &Config{
+	invalidEnv = nil
+	cfg := &Config{
 		DBHost:       getEnvAny([]string{"DB_HOST", "POSTGRES_HOST"}, "localhost"),
 		DBPort:       getEnvAny([]string{"DB_PORT", "POSTGRES_PORT"}, "5432"),
 		DBUser:       getEnvAny([]string{"DB_USER", "POSTGRES_USER"}, "postgres"),
@@ -42,7 +131,104 @@ func Load() *Config {
 		ContactEmail: getEnv("CONTACT_EMAIL", "comercialjam@zohomail.com"),
 		FromEmail:    getEnv("FROM_EMAIL", "comercialjam@zohomail.com"),
 		FromName:     getEnv("FROM_NAME", "JAM Locação de Guindastes"),
+
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		PasswordResetTTL:      getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetURL:      getEnv("PASSWORD_RESET_URL", ""),
+		PasswordResetCooldown: getEnvDuration("PASSWORD_RESET_COOLDOWN", 5*time.Minute),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "Multi Upload API"),
+		MFAChallengeTTL: getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		StorageDriver:  getEnv("STORAGE_DRIVER", "local"),
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnv("S3_BUCKET", ""),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		S3UsePathStyle: getEnvBool("S3_USE_PATH_STYLE", true),
+
+		AllowedImageTypes: getEnvList("ALLOWED_IMAGE_TYPES", []string{
+			"image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp",
+			"image/tiff", "image/heic", "image/heif", "image/avif", "image/vnd.mozilla.apng",
+		}),
+		AllowedVideoTypes: getEnvList("ALLOWED_VIDEO_TYPES", []string{
+			"video/mp4", "video/quicktime", "video/webm", "video/x-matroska", "video/x-msvideo",
+			"video/mpeg", "video/3gpp", "video/x-m4v", "video/ogg",
+		}),
+
+		URLSigningSecret: getEnvAny([]string{"URL_SIGNING_SECRET", "JWT_SECRET"}, "your-secret-key"),
+		SignedURLTTL:     getEnvDuration("SIGNED_URL_TTL", time.Hour),
+		SignedURLMaxTTL:  getEnvDuration("SIGNED_URL_MAX_TTL", 7*24*time.Hour),
+
+		MaxImageSize: getEnvSize("MAX_IMAGE_SIZE", 50<<20),
+		MaxVideoSize: getEnvSize("MAX_VIDEO_SIZE", 0),
+
+		DefaultVisibility: getEnv("DEFAULT_VISIBILITY", string(models.VisibilityPrivate)),
+
+		RejectDuplicates: getEnvBool("REJECT_DUPLICATES", false),
+
+		DefaultQuotaBytes: getEnvSize("DEFAULT_QUOTA_BYTES", 0),
+		DefaultQuotaFiles: getEnvInt("DEFAULT_QUOTA_FILES", 0),
+
+		MediaVersionRetention: getEnvInt("MEDIA_VERSION_RETENTION", 10),
+		TrashRetentionDays:    getEnvInt("TRASH_RETENTION_DAYS", 30),
+
+		TusUploadTTL: getEnvDuration("TUS_UPLOAD_TTL", 24*time.Hour),
+
+		ProcessingWorkers:   getEnvInt("PROCESSING_WORKERS", 2),
+		ImageVariantWidths:  getEnvIntList("IMAGE_VARIANT_WIDTHS", []int{320, 640, 1280}),
+		ImageVariantFormats: imageVariantFormats(getEnvList("IMAGE_VARIANT_FORMATS", []string{"jpeg"})),
+		ImageVariantQuality: getEnvInt("IMAGE_VARIANT_QUALITY", 82),
+		VideoProcessing:     getEnvBool("VIDEO_PROCESSING", true),
+		FFprobePath:         getEnv("FFPROBE_PATH", "ffprobe"),
+		FFmpegPath:          getEnv("FFMPEG_PATH", "ffmpeg"),
+
+		HLSPackaging:      getEnvBool("HLS_PACKAGING", false),
+		HLSRenditions:     getEnvIntList("HLS_RENDITIONS", []int{360, 720, 1080}),
+		HLSSegmentSeconds: getEnvInt("HLS_SEGMENT_SECONDS", 6),
+	}
+	cfg.invalidEnv = invalidEnv
+	return cfg
+}
+
+// Validate confere os valores que não têm um padrão seguro quando inválidos,
+// para que o servidor não inicie com uma configuração ignorada em silêncio
+func (c *Config) Validate() error {
+	if len(c.invalidEnv) > 0 {
+		return fmt.Errorf("valores inválidos: %s", strings.Join(c.invalidEnv, ", "))
+	}
+	if !models.Visibility(c.DefaultVisibility).Valid() {
+		return fmt.Errorf("DEFAULT_VISIBILITY inválida: %q (use private, unlisted ou public)", c.DefaultVisibility)
+	}
+	// Não há codificador WebP (ou outro formato) disponível: um formato
+	// desconhecido deixaria as imagens sem as variantes pedidas
+	for _, format := range c.ImageVariantFormats {
+		if format != "jpeg" && format != "png" {
+			return fmt.Errorf("IMAGE_VARIANT_FORMATS: formato não suportado: %q (use jpeg e/ou png)", format)
+		}
+	}
+	if c.PasswordResetURL != "" {
+		if u, err := url.Parse(c.PasswordResetURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("PASSWORD_RESET_URL inválida: %q (use uma URL absoluta)", c.PasswordResetURL)
+		}
+	}
+	return nil
+}
+
+// imageVariantFormats normaliza os nomes dos formatos das variantes
+func imageVariantFormats(formats []string) []string {
+	normalized := make([]string, 0, len(formats))
+	for _, format := range formats {
+		format = strings.ToLower(format)
+		if format == "jpg" {
+			format = "jpeg"
+		}
+		normalized = append(normalized, format)
 	}
+	return normalized
 }
 
 func (c *Config) DatabaseURL() string {
@@ -65,3 +251,107 @@ func getEnvAny(keys []string, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		invalidEnv = append(invalidEnv, fmt.Sprintf("%s=%q", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration lê uma duração no formato do Go (ex.: "90m", "24h")
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvSize lê um tamanho em bytes, aceitando sufixos como "500MB" ou "10GB"
+func getEnvSize(key string, defaultValue int64) int64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := ParseSize(raw)
+	if err != nil {
+		invalidEnv = append(invalidEnv, fmt.Sprintf("%s=%q", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+// sizeUnits são os sufixos aceitos por ParseSize, em múltiplos de 1024
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseSize converte um tamanho como "1048576", "500MB" ou "10GB" em bytes
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("tamanho inválido: %s", value)
+	}
+	return size * multiplier, nil
+}
+
+// getEnvList lê uma lista separada por vírgulas
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvIntList(key string, defaultValue []int) []int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+
+	var values []int
+	for _, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil || value <= 0 {
+			invalidEnv = append(invalidEnv, fmt.Sprintf("%s=%q", key, os.Getenv(key)))
+			return defaultValue
+		}
+		values = append(values, value)
+	}
+	return values
+}
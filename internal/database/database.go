@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
 
 	_ "github.com/lib/pq"
 )
@@ -26,7 +28,7 @@ func Connect(databaseURL string) (*sql.DB, error) {
 	return db, nil
 }
 
-// RunMigrations executa as migrations do banco de dados
+// RunMigrations aplica todas as migrations pendentes
 func RunMigrations(databaseURL string) error {
 	db, err := Connect(databaseURL)
 	if err != nil {
@@ -34,53 +36,14 @@ func RunMigrations(databaseURL string) error {
 	}
 	defer db.Close()
 
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS media (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			filename VARCHAR(255) NOT NULL,
-			original_name VARCHAR(255) NOT NULL,
-			file_path VARCHAR(500) NOT NULL,
-			file_size BIGINT NOT NULL,
-			mime_type VARCHAR(100) NOT NULL,
-			media_type VARCHAR(10) NOT NULL CHECK (media_type IN ('image', 'video')),
-			sort_order INTEGER DEFAULT 0,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_media_user_id ON media(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_media_sort_order ON media(sort_order)`,
-		`CREATE INDEX IF NOT EXISTS idx_media_created_at ON media(created_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_media_media_type ON media(media_type)`,
-		`CREATE OR REPLACE FUNCTION update_updated_at_column()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			NEW.updated_at = CURRENT_TIMESTAMP;
-			RETURN NEW;
-		END;
-		$$ language 'plpgsql'`,
-		`DROP TRIGGER IF EXISTS update_users_updated_at ON users`,
-		`CREATE TRIGGER update_users_updated_at 
-			BEFORE UPDATE ON users 
-			FOR EACH ROW EXECUTE FUNCTION update_updated_at_column()`,
-		`DROP TRIGGER IF EXISTS update_media_updated_at ON media`,
-		`CREATE TRIGGER update_media_updated_at 
-			BEFORE UPDATE ON media 
-			FOR EACH ROW EXECUTE FUNCTION update_updated_at_column()`,
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
 	}
 
-	for i, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("erro na migration %d: %w", i+1, err)
-		}
+	applied, err := migrator.Up(context.Background())
+	for _, migration := range applied {
+		log.Printf("Migration aplicada: %04d_%s", migration.Version, migration.Name)
 	}
-
-	return nil
+	return err
 }
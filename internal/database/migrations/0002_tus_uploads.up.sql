@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL DEFAULT '',
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(100) NOT NULL DEFAULT '',
+    media_id INTEGER REFERENCES media(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_user_id ON tus_uploads(user_id);
+
+DROP TRIGGER IF EXISTS update_tus_uploads_updated_at ON tus_uploads;
+CREATE TRIGGER update_tus_uploads_updated_at
+    BEFORE UPDATE ON tus_uploads
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
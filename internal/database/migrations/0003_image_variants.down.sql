@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS media_variants;
+ALTER TABLE media DROP COLUMN IF EXISTS processed_at;
@@ -0,0 +1,17 @@
+ALTER TABLE media ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS media_variants (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    file_size BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (media_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_variants_media_id ON media_variants(media_id);
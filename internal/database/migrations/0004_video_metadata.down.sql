@@ -0,0 +1,5 @@
+ALTER TABLE media DROP COLUMN IF EXISTS poster_path;
+ALTER TABLE media DROP COLUMN IF EXISTS video_codec;
+ALTER TABLE media DROP COLUMN IF EXISTS height;
+ALTER TABLE media DROP COLUMN IF EXISTS width;
+ALTER TABLE media DROP COLUMN IF EXISTS duration;
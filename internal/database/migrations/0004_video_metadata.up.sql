@@ -0,0 +1,5 @@
+ALTER TABLE media ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS height INTEGER;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS video_codec VARCHAR(50);
+ALTER TABLE media ADD COLUMN IF NOT EXISTS poster_path VARCHAR(500);
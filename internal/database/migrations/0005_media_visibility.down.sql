@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_media_variants_file_path;
+DROP INDEX IF EXISTS idx_media_file_path;
+ALTER TABLE media DROP COLUMN IF EXISTS visibility;
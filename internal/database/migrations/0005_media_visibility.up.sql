@@ -0,0 +1,10 @@
+-- DEFAULT 'public' é proposital: preenche as mídias já existentes com o
+-- comportamento anterior, em que todas eram acessíveis pela URL do arquivo.
+-- As novas mídias sempre recebem a visibilidade explicitamente (padrão de
+-- DEFAULT_VISIBILITY no upload; privada quando nenhuma é informada).
+ALTER TABLE media ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('private', 'unlisted', 'public'));
+
+CREATE INDEX IF NOT EXISTS idx_media_visibility ON media(visibility);
+CREATE INDEX IF NOT EXISTS idx_media_file_path ON media(file_path);
+CREATE INDEX IF NOT EXISTS idx_media_variants_file_path ON media_variants(file_path);
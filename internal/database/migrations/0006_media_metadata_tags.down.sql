@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS media_tags;
+DROP TABLE IF EXISTS tags;
+ALTER TABLE media DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE media DROP COLUMN IF EXISTS description;
+ALTER TABLE media DROP COLUMN IF EXISTS title;
@@ -0,0 +1,15 @@
+CREATE TABLE media_versions (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    media_type VARCHAR(10) NOT NULL CHECK (media_type IN ('image', 'video')),
+    replaced_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_versions_media_id ON media_versions(media_id, replaced_at DESC);
+CREATE INDEX idx_media_versions_file_path ON media_versions(file_path);
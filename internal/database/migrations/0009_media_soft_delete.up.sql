@@ -0,0 +1,3 @@
+ALTER TABLE media ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_media_deleted_at ON media(deleted_at) WHERE deleted_at IS NOT NULL;
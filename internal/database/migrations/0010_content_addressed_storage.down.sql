@@ -0,0 +1,3 @@
+ALTER TABLE media_versions DROP COLUMN IF EXISTS checksum;
+ALTER TABLE media DROP COLUMN IF EXISTS checksum;
+DROP TABLE IF EXISTS blobs;
@@ -0,0 +1,12 @@
+CREATE TABLE blobs (
+    checksum CHAR(64) PRIMARY KEY,
+    file_path VARCHAR(500) NOT NULL,
+    file_size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE media ADD COLUMN checksum CHAR(64);
+ALTER TABLE media_versions ADD COLUMN checksum CHAR(64);
+
+CREATE INDEX idx_media_user_checksum ON media(user_id, checksum) WHERE checksum IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE media DROP COLUMN IF EXISTS broken_reason;
+ALTER TABLE media DROP COLUMN IF EXISTS broken_at;
@@ -0,0 +1,2 @@
+ALTER TABLE media ADD COLUMN broken_at TIMESTAMP;
+ALTER TABLE media ADD COLUMN broken_reason VARCHAR(255);
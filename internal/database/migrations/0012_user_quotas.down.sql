@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS quota_files;
+ALTER TABLE users DROP COLUMN IF EXISTS quota_bytes;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN quota_bytes BIGINT;
+ALTER TABLE users ADD COLUMN quota_files INTEGER;
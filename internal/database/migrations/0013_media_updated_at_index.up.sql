@@ -0,0 +1 @@
+CREATE INDEX idx_media_updated_at ON media(updated_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS media_renditions (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    bandwidth INTEGER NOT NULL,
+    playlist_path VARCHAR(500) NOT NULL,
+    file_size BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (media_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_renditions_media_id ON media_renditions(media_id);
+CREATE INDEX IF NOT EXISTS idx_media_renditions_playlist_path ON media_renditions(playlist_path);
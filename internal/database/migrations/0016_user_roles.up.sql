@@ -0,0 +1,5 @@
+-- Usuários existentes tinham acesso total: passam a ser administradores
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'admin'
+    CHECK (role IN ('admin', 'editor', 'viewer'));
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'viewer';
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
@@ -0,0 +1,31 @@
+-- Autenticação em dois fatores (TOTP). O segredo é gravado na configuração e
+-- só passa a ser exigido no login depois de confirmado (mfa_enabled_at).
+-- totp_last_step impede que o mesmo código seja usado duas vezes.
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT;
+ALTER TABLE users ADD COLUMN mfa_enabled_at TIMESTAMP;
+
+CREATE TABLE mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Desafios da segunda etapa do login, com limite de tentativas
+CREATE TABLE mfa_challenges (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
+
+-- Papéis para os quais a autenticação em dois fatores é obrigatória
+CREATE TABLE mfa_required_roles (
+    role VARCHAR(20) PRIMARY KEY CHECK (role IN ('admin', 'editor', 'viewer'))
+);
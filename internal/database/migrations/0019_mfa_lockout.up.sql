@@ -0,0 +1,5 @@
+-- Falhas consecutivas de código de dois fatores, contadas por usuário em
+-- todas as rotas que conferem um código (login, ativação, desativação e
+-- geração de códigos de recuperação), e o bloqueio temporário resultante
+ALTER TABLE users ADD COLUMN mfa_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN mfa_locked_until TIMESTAMP;
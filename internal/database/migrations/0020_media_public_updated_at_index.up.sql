@@ -0,0 +1,3 @@
+-- Validação do cache da galeria (COUNT e MAX(updated_at) das mídias públicas
+-- fora da lixeira) apenas pelo índice, sem percorrer a tabela
+CREATE INDEX idx_media_public_updated_at ON media(visibility, updated_at) WHERE deleted_at IS NULL;
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"multi-upload-api/internal/middleware"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSlugAttempts limita as tentativas de gerar um slug livre a partir do título
+const maxSlugAttempts = 50
+
+type AlbumHandler struct {
+	albumRepo *repository.AlbumRepository
+	mediaRepo *repository.MediaRepository
+}
+
+func NewAlbumHandler(albumRepo *repository.AlbumRepository, mediaRepo *repository.MediaRepository) *AlbumHandler {
+	return &AlbumHandler{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// Create cria um novo álbum
+func (h *AlbumHandler) Create(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	var req models.AlbumCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	album := &models.Album{
+		UserID:      userID,
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+	}
+	if album.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Título é obrigatório"})
+		return
+	}
+
+	if req.CoverMediaID != nil && *req.CoverMediaID != 0 {
+		if _, err := h.mediaRepo.GetByID(*req.CoverMediaID, userID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Mídia de capa não encontrada"})
+			return
+		}
+		album.CoverMediaID = req.CoverMediaID
+	}
+
+	// Slug informado explicitamente precisa estar livre; slug gerado a partir
+	// do título recebe um sufixo numérico em caso de conflito
+	var err error
+	if req.Slug != "" {
+		album.Slug = models.Slugify(req.Slug)
+		if album.Slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slug inválido"})
+			return
+		}
+		err = h.albumRepo.Create(album)
+	} else {
+		base := models.Slugify(album.Title)
+		if base == "" {
+			base = "album"
+		}
+		for attempt := 1; attempt <= maxSlugAttempts; attempt++ {
+			album.Slug = base
+			if attempt > 1 {
+				album.Slug = fmt.Sprintf("%s-%d", base, attempt)
+			}
+			if err = h.albumRepo.Create(album); !errors.Is(err, repository.ErrSlugTaken) {
+				break
+			}
+		}
+	}
+
+	if errors.Is(err, repository.ErrSlugTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug já está em uso"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar álbum"})
+		return
+	}
+
+	h.attachCovers([]*models.Album{album}, repository.MediaScope{UserID: album.UserID})
+
+	c.JSON(http.StatusCreated, album)
+}
+
+// List lista os álbuns do usuário. Viewers listam também os álbuns dos
+// demais usuários que tenham mídias públicas (ver readScope).
+func (h *AlbumHandler) List(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	scope := readScope(c, userID)
+	albums, err := h.albumRepo.List(userID, scope.Shared)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar álbuns"})
+		return
+	}
+
+	refs := make([]*models.Album, len(albums))
+	for i := range albums {
+		refs[i] = &albums[i]
+	}
+	h.attachCovers(refs, scope)
+
+	c.JSON(http.StatusOK, models.AlbumListResponse{
+		Data:    albums,
+		Total:   len(albums),
+		Message: "Álbuns listados com sucesso",
+	})
+}
+
+// Get busca um álbum do usuário com suas mídias, na ordem do álbum. Viewers
+// também consultam os álbuns dos demais usuários, apenas com as mídias
+// públicas (ver readScope).
+func (h *AlbumHandler) Get(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	scope := readScope(c, userID)
+	album, ok := h.findAlbum(c, userID, scope.Shared != nil)
+	if !ok {
+		return
+	}
+
+	h.respondAlbum(c, album, scope)
+}
+
+// GetPublic busca um álbum pelo slug para a galeria pública. Apenas as
+// mídias públicas do álbum são retornadas.
+func (h *AlbumHandler) GetPublic(c *gin.Context) {
+	album, err := h.albumRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Álbum não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar álbum"})
+		return
+	}
+
+	h.respondAlbum(c, album, galleryScope)
+}
+
+// Update atualiza os dados de um álbum
+func (h *AlbumHandler) Update(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	var req models.AlbumUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	album, ok := h.findAlbum(c, userID, false)
+	if !ok {
+		return
+	}
+
+	// Atualizar campos
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Título é obrigatório"})
+			return
+		}
+		album.Title = title
+	}
+	if req.Slug != nil {
+		slug := models.Slugify(*req.Slug)
+		if slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slug inválido"})
+			return
+		}
+		album.Slug = slug
+	}
+	if req.Description != nil {
+		album.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.CoverMediaID != nil {
+		if *req.CoverMediaID == 0 {
+			album.CoverMediaID = nil
+		} else {
+			if _, err := h.mediaRepo.GetByID(*req.CoverMediaID, userID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Mídia de capa não encontrada"})
+				return
+			}
+			album.CoverMediaID = req.CoverMediaID
+		}
+	}
+
+	if err := h.albumRepo.Update(album); err != nil {
+		if errors.Is(err, repository.ErrSlugTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug já está em uso"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar álbum"})
+		return
+	}
+
+	h.attachCovers([]*models.Album{album}, repository.MediaScope{UserID: album.UserID})
+
+	c.JSON(http.StatusOK, album)
+}
+
+// Delete exclui um álbum. As mídias do álbum não são excluídas.
+func (h *AlbumHandler) Delete(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := h.albumRepo.Delete(id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Álbum não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir álbum"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Álbum excluído com sucesso"})
+}
+
+// AddMedia adiciona mídias ao final do álbum
+func (h *AlbumHandler) AddMedia(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	var req models.AlbumMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	if len(req.MediaIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs não pode estar vazia"})
+		return
+	}
+
+	album, ok := h.findAlbum(c, userID, false)
+	if !ok {
+		return
+	}
+
+	added, err := h.albumRepo.AddMedia(album.ID, userID, req.MediaIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao adicionar arquivos ao álbum"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"added":   added,
+		"message": fmt.Sprintf("%d arquivo(s) adicionado(s) ao álbum", added),
+	})
+}
+
+// RemoveMedia remove uma mídia do álbum
+func (h *AlbumHandler) RemoveMedia(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	mediaID, err := strconv.Atoi(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	album, ok := h.findAlbum(c, userID, false)
+	if !ok {
+		return
+	}
+
+	if err := h.albumRepo.RemoveMedia(album.ID, mediaID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não pertence ao álbum"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover arquivo do álbum"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Arquivo removido do álbum com sucesso"})
+}
+
+// UpdateSortOrder atualiza a ordem das mídias dentro do álbum
+func (h *AlbumHandler) UpdateSortOrder(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	var req models.SortOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	if len(req.MediaIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs não pode estar vazia"})
+		return
+	}
+
+	album, ok := h.findAlbum(c, userID, false)
+	if !ok {
+		return
+	}
+
+	if err := h.albumRepo.UpdateSortOrders(album.ID, req.MediaIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar ordem"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ordem atualizada com sucesso"})
+}
+
+// findAlbum busca o álbum do parâmetro :id do usuário (ou, com anyOwner, de
+// qualquer usuário), respondendo com erro quando não for encontrado
+func (h *AlbumHandler) findAlbum(c *gin.Context, userID int, anyOwner bool) (*models.Album, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil, false
+	}
+
+	var album *models.Album
+	if anyOwner {
+		album, err = h.albumRepo.FindByID(id)
+	} else {
+		album, err = h.albumRepo.GetByID(id, userID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Álbum não encontrado"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar álbum"})
+		return nil, false
+	}
+
+	return album, true
+}
+
+// galleryScope restringe os álbuns da galeria pública às mídias públicas
+var galleryScope = repository.MediaScope{Shared: []models.Visibility{models.VisibilityPublic}}
+
+// respondAlbum responde com o álbum e uma página das mídias do escopo
+func (h *AlbumHandler) respondAlbum(c *gin.Context, album *models.Album, scope repository.MediaScope) {
+	// Parâmetros de paginação
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	// Validar parâmetros
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// As mídias do álbum pertencem ao dono: ele vê todas; os demais, apenas
+	// as visibilidades do escopo
+	var visible []models.Visibility
+	if album.UserID != scope.UserID {
+		visible = scope.Shared
+	}
+	medias, total, err := h.mediaRepo.ListByAlbum(album.ID, page, pageSize, visible)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivos do álbum"})
+		return
+	}
+	if medias == nil {
+		medias = []models.Media{}
+	}
+
+	h.attachCovers([]*models.Album{album}, scope)
+	if visible != nil {
+		// Fora do próprio álbum a contagem considera apenas as mídias visíveis
+		album.MediaCount = total
+	}
+
+	c.JSON(http.StatusOK, models.AlbumResponse{
+		Album:      *album,
+		Media:      medias,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int(math.Ceil(float64(total) / float64(pageSize))),
+		Message:    "Álbum encontrado com sucesso",
+	})
+}
+
+// attachCovers carrega as mídias de capa dos álbuns. Capas de outros
+// usuários fora das visibilidades do escopo são omitidas.
+func (h *AlbumHandler) attachCovers(albums []*models.Album, scope repository.MediaScope) {
+	var ids []int
+	for _, album := range albums {
+		if album.CoverMediaID != nil {
+			ids = append(ids, *album.CoverMediaID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	covers, err := h.mediaRepo.ListByIDs(ids)
+	if err != nil {
+		return
+	}
+
+	byID := make(map[int]*models.Media, len(covers))
+	for i := range covers {
+		if covers[i].UserID != scope.UserID && !slices.Contains(scope.Shared, covers[i].Visibility) {
+			continue
+		}
+		byID[covers[i].ID] = &covers[i]
+	}
+
+	for _, album := range albums {
+		if album.CoverMediaID != nil {
+			album.Cover = byID[*album.CoverMediaID]
+		}
+	}
+}
@@ -2,27 +2,43 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"log"
 	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/config"
 	"multi-upload-api/internal/models"
 	"multi-upload-api/internal/repository"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// maxMFAAttempts limita as tentativas de código em cada desafio de login
+const maxMFAAttempts = 5
+
 type AuthHandler struct {
 	userRepo   *repository.UserRepository
+	tokenRepo  *repository.TokenRepository
+	mfaRepo    *repository.MFARepository
 	jwtService *auth.JWTService
+	cfg        *config.Config
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, mfaRepo *repository.MFARepository, jwtService *auth.JWTService, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
 		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		mfaRepo:    mfaRepo,
 		jwtService: jwtService,
+		cfg:        cfg,
 	}
 }
 
-// Login autentica o usuário e retorna um token JWT
+// Login autentica o usuário e abre uma sessão, retornando um access token de
+// curta duração e um refresh token. Com a autenticação em dois fatores ativa,
+// retorna apenas um desafio, a ser respondido com o código em VerifyMFA.
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -56,8 +72,127 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Gerar token
-	token, err := h.jwtService.GenerateToken(user)
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Usuário desativado",
+		})
+		return
+	}
+
+	// Aproveitar o login para descartar tokens e revogações vencidos
+	if err := h.tokenRepo.DeleteExpired(); err != nil {
+		log.Printf("Erro ao remover tokens expirados: %v", err)
+	}
+	if err := h.mfaRepo.DeleteExpiredChallenges(); err != nil {
+		log.Printf("Erro ao remover desafios expirados: %v", err)
+	}
+
+	if user.MFAEnabledAt != nil {
+		h.startMFAChallenge(c, user)
+		return
+	}
+
+	h.openSession(c, user)
+}
+
+// VerifyMFA conclui o login de um usuário com autenticação em dois fatores,
+// com um código TOTP ou de recuperação. Cada desafio aceita poucas tentativas.
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	challenge := auth.HashMFAChallenge(req.MFAToken)
+	userID, err := h.mfaRepo.AttemptChallenge(challenge, maxMFAAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Desafio inválido ou expirado; faça login novamente",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro interno do servidor",
+		})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao buscar usuário",
+		})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Usuário desativado",
+		})
+		return
+	}
+
+	valid, err := verifySecondFactor(h.mfaRepo, user, req.Code)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Código inválido",
+		})
+		return
+	}
+
+	if err := h.mfaRepo.DeleteChallenge(challenge); err != nil {
+		log.Printf("Erro ao remover desafio de login: %v", err)
+	}
+
+	h.openSession(c, user)
+}
+
+// startMFAChallenge cria o desafio da segunda etapa do login
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, user *models.User) {
+	token, hash, err := auth.GenerateMFAChallenge()
+	expiresAt := time.Now().Add(h.cfg.MFAChallengeTTL)
+	if err == nil {
+		err = h.mfaRepo.CreateChallenge(user.ID, hash, expiresAt)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao gerar desafio",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// openSession abre uma nova sessão (família de refresh tokens) para o
+// usuário autenticado e responde com os tokens
+func (h *AuthHandler) openSession(c *gin.Context, user *models.User) {
+	refreshToken, next, err := h.newRefreshToken()
+	if err == nil {
+		next.UserID = user.ID
+		next.FamilyID = uuid.New().String()
+		err = h.tokenRepo.CreateRefreshToken(next)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao gerar token",
+		})
+		return
+	}
+
+	tokens, err := h.tokenResponse(user, refreshToken, next)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Erro ao gerar token",
@@ -66,13 +201,148 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	response := models.LoginResponse{
-		Token: token,
-		User:  *user,
+		TokenResponse: *tokens,
+		User:          *user,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// Refresh troca um refresh token por um novo par de tokens. O refresh token
+// usado deixa de valer; se ele for apresentado de novo, a sessão inteira é
+// encerrada, pois isso indica que o token vazou. Tokens de usuários
+// desativados são recusados sem que um novo token seja emitido.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	refreshToken, next, err := h.newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao gerar token",
+		})
+		return
+	}
+
+	err = h.tokenRepo.RotateRefreshToken(auth.HashRefreshToken(req.RefreshToken), next)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTokenReused):
+			log.Printf("Refresh token reutilizado: sessão %s encerrada", next.FamilyID)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Refresh token já utilizado; a sessão foi encerrada",
+			})
+		case errors.Is(err, repository.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Usuário desativado",
+			})
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Refresh token inválido ou expirado",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Erro ao renovar token",
+			})
+		}
+		return
+	}
+
+	// O papel e a exigência de autenticação em dois fatores são lidos do
+	// usuário atual, não do token anterior
+	user, err := h.userRepo.GetByID(next.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao buscar usuário",
+		})
+		return
+	}
+
+	tokens, err := h.tokenResponse(user, refreshToken, next)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao gerar token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout encerra a sessão do access token enviado: ele e todos os refresh
+// tokens da sessão deixam de valer
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	tokenID := c.GetString("token_id")
+	if tokenID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	if err := h.tokenRepo.RevokeSession(sessionID, tokenID, c.GetTime("token_expires_at")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao encerrar sessão",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessão encerrada com sucesso",
+	})
+}
+
+// newRefreshToken gera um refresh token e o registro a ser gravado, com o jti
+// e a validade do access token que será emitido junto
+func (h *AuthHandler) newRefreshToken() (string, *models.RefreshToken, error) {
+	token, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	return token, &models.RefreshToken{
+		TokenHash:       hash,
+		AccessTokenID:   uuid.New().String(),
+		AccessExpiresAt: now.Add(h.cfg.AccessTokenTTL),
+		ExpiresAt:       now.Add(h.cfg.RefreshTokenTTL),
+	}, nil
+}
+
+// tokenResponse assina o access token registrado em stored e monta a
+// resposta. O token indica se o usuário ainda precisa configurar a
+// autenticação em dois fatores exigida para o seu papel.
+func (h *AuthHandler) tokenResponse(user *models.User, refreshToken string, stored *models.RefreshToken) (*models.TokenResponse, error) {
+	setupRequired := false
+	if user.MFAEnabledAt == nil {
+		required, err := h.mfaRepo.IsRequired(user.Role)
+		if err != nil {
+			return nil, err
+		}
+		setupRequired = required
+	}
+
+	token, err := h.jwtService.GenerateToken(user, stored.FamilyID, stored.AccessTokenID, stored.AccessExpiresAt, setupRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		Token:            token,
+		ExpiresAt:        stored.AccessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+		MFASetupRequired: setupRequired,
+	}, nil
+}
+
 // Me retorna informações do usuário autenticado
 func (h *AuthHandler) Me(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxFileMaxAge é o maior tempo de cache de um arquivo, usado apenas em
+	// blobs, cujo conteúdo é identificado pela própria chave (SHA-256)
+	maxFileMaxAge = 365 * 24 * time.Hour
+	// publicFileMaxAge limita por quanto tempo caches compartilhados (CDN)
+	// continuam entregando um arquivo público depois que a mídia passa a ser
+	// privada ou é excluída
+	publicFileMaxAge = 5 * time.Minute
+	// galleryCacheControl permite guardar a galeria, mas exige revalidação a
+	// cada acesso (respondida com 304 enquanto nada mudar)
+	galleryCacheControl = "public, no-cache"
+)
+
+// fileCacheControl monta o Cache-Control de um arquivo. Arquivos públicos
+// ficam pouco tempo em cache; os privados só são guardados pelo navegador,
+// até o vencimento da URL assinada, ou revalidados a cada acesso quando
+// entregues ao dono autenticado. Apenas blobs são marcados como imutáveis.
+func fileCacheControl(public, contentAddressed bool, signedUntil, now time.Time) string {
+	scope := "private"
+	var maxAge time.Duration
+	switch {
+	case public:
+		scope, maxAge = "public", publicFileMaxAge
+	case !signedUntil.IsZero():
+		maxAge = signedUntil.Sub(now)
+	}
+	if maxAge > maxFileMaxAge {
+		maxAge = maxFileMaxAge
+	}
+	if maxAge < time.Second {
+		return scope + ", no-cache"
+	}
+
+	value := fmt.Sprintf("%s, max-age=%d", scope, int64(maxAge/time.Second))
+	if contentAddressed {
+		value += ", immutable"
+	}
+	return value
+}
+
+// strongETag gera um ETag forte a partir dos valores que identificam a versão
+// de um recurso
+func strongETag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified avalia If-None-Match e, na ausência dele, If-Modified-Since.
+// Quando o recurso não mudou responde 304 e retorna true; os headers de cache
+// devem ter sido definidos antes.
+func notModified(c *gin.Context, etag string, modTime time.Time) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if !etagMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+		if err != nil || modTime.IsZero() || modTime.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compara um ETag com a lista de um header If-None-Match, usando
+// a comparação fraca (RFC 7232)
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,35 +1,65 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"math"
+	"mime"
+	"mime/multipart"
+	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/blobs"
+	"multi-upload-api/internal/config"
 	"multi-upload-api/internal/middleware"
 	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/processing"
 	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
 	"net/http"
-	"os"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type MediaHandler struct {
-	mediaRepo  *repository.MediaRepository
-	uploadPath string
+	mediaRepo *repository.MediaRepository
+	userRepo  *repository.UserRepository
+	storage   storage.Backend
+	blobs     *blobs.Store
+	signer    *auth.URLSigner
+	processor *processing.Worker
+	cfg       *config.Config
 }
 
-func NewMediaHandler(mediaRepo *repository.MediaRepository, uploadPath string) *MediaHandler {
+func NewMediaHandler(mediaRepo *repository.MediaRepository, userRepo *repository.UserRepository, store storage.Backend, blobStore *blobs.Store, signer *auth.URLSigner, processor *processing.Worker, cfg *config.Config) *MediaHandler {
 	return &MediaHandler{
-		mediaRepo:  mediaRepo,
-		uploadPath: uploadPath,
+		mediaRepo: mediaRepo,
+		userRepo:  userRepo,
+		storage:   store,
+		blobs:     blobStore,
+		signer:    signer,
+		processor: processor,
+		cfg:       cfg,
 	}
 }
 
-// Upload faz upload de arquivos de mídia
+// uploadFields são os campos multipart aceitos pelo upload
+var uploadFields = map[string]bool{"files[]": true, "files": true, "file": true}
+
+// Upload faz upload de um ou mais arquivos de mídia em uma única requisição.
+// As partes do formulário são lidas em sequência e gravadas diretamente no
+// armazenamento, sem buffer em memória ou arquivos temporários.
 func (h *MediaHandler) Upload(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
 	if !exists {
@@ -37,84 +67,506 @@ func (h *MediaHandler) Upload(c *gin.Context) {
 		return
 	}
 
-	// Parse multipart form
-	err := c.Request.ParseMultipartForm(1024 << 20) // 1GB max
+	// Verificar a cota antes de gravar qualquer arquivo
+	remainingBytes, remainingFiles, err := h.remainingQuota(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao processar formulário"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar cota"})
+		return
+	}
+	if remainingBytes == 0 || remainingFiles == 0 {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quotaExceeded.Message, "code": quotaExceeded.Code})
 		return
 	}
 
-	file, header, err := c.Request.FormFile("file")
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao processar formulário"})
+		return
+	}
+
+	var results []models.UploadResult
+	var medias []*models.Media
+	aborted := false    // um arquivo ultrapassou o tamanho máximo e o envio foi interrompido
+	incomplete := false // o formulário terminou antes do fim (requisição interrompida ou malformada)
+	var stored []int    // índices de results com arquivo salvo no armazenamento
+
+	visibility := models.Visibility(h.cfg.DefaultVisibility)
+	rejectDuplicates := h.cfg.RejectDuplicates
+	seen := map[string]int{}     // checksum -> índice em medias do primeiro arquivo do lote
+	var batchDuplicates [][2]int // pares (índice em results, índice em medias do original)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Requisição interrompida ou formulário malformado: os arquivos já
+			// recebidos por completo são mantidos, mas a falha é informada
+			incomplete = true
+			break
+		}
+
+		// Campos de texto valem para os arquivos enviados depois deles
+		if part.FileName() == "" && part.FormName() == "visibility" {
+			value, _ := io.ReadAll(io.LimitReader(part, 32))
+			part.Close()
+			visibility = models.Visibility(strings.TrimSpace(string(value)))
+			if !visibility.Valid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Visibilidade inválida"})
+				return
+			}
+			continue
+		}
+		if part.FileName() == "" && part.FormName() == "on_duplicate" {
+			value, _ := io.ReadAll(io.LimitReader(part, 32))
+			part.Close()
+			switch strings.TrimSpace(string(value)) {
+			case "reject":
+				rejectDuplicates = true
+			case "allow":
+				rejectDuplicates = false
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Valor inválido para on_duplicate (use reject ou allow)"})
+				return
+			}
+			continue
+		}
+
+		if part.FileName() == "" || !uploadFields[part.FormName()] {
+			part.Close()
+			continue
+		}
+
+		result := models.UploadResult{OriginalName: part.FileName()}
+		if remainingBytes == 0 || remainingFiles == 0 {
+			part.Close()
+			result.Error = quotaError()
+			results = append(results, result)
+			continue
+		}
+
+		media, uploadErr := h.storeFile(c.Request.Context(), limitQuota(part, remainingBytes), -1, part.FileName(), part.Header.Get("Content-Type"))
+		part.Close()
+
+		// Arquivo acima do tamanho máximo: parar de ler o formulário em vez
+		// de receber o restante dele; os arquivos anteriores são mantidos
+		if uploadErr != nil && uploadErr.Code == fileTooLargeCode {
+			result.Error = uploadErr
+			results = append(results, result)
+			aborted = true
+			break
+		}
+
+		if uploadErr == nil {
+			result.DuplicateOf, uploadErr = h.checkDuplicate(c.Request.Context(), userID, media, rejectDuplicates)
+		}
+		if uploadErr == nil {
+			if first, ok := seen[*media.Checksum]; ok && result.DuplicateOf == nil {
+				// Mesmo conteúdo de um arquivo anterior do lote, que ainda não tem ID
+				if rejectDuplicates {
+					h.releaseFile(c.Request.Context(), media)
+					uploadErr = &models.UploadError{Code: "duplicate", Message: "Arquivo repetido no envio"}
+				} else {
+					batchDuplicates = append(batchDuplicates, [2]int{len(results), first})
+				}
+			} else if !ok {
+				seen[*media.Checksum] = len(medias)
+			}
+		}
+
+		if uploadErr != nil {
+			result.Error = uploadErr
+		} else {
+			media.UserID = userID
+			media.Visibility = visibility
+			medias = append(medias, media)
+			stored = append(stored, len(results))
+
+			if remainingBytes > 0 {
+				remainingBytes -= media.FileSize
+			}
+			if remainingFiles > 0 {
+				remainingFiles--
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 && incomplete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao processar formulário"})
+		return
+	}
+	if len(results) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
 		return
 	}
-	defer file.Close()
+
+	// Salvar no banco de dados todos os arquivos aceitos de uma só vez. A
+	// cota é conferida de novo na transação: envios simultâneos do mesmo
+	// usuário podem ter passado juntos pela verificação inicial
+	if err := h.mediaRepo.CreateBatch(medias, h.defaultQuota()); err != nil {
+		for j, media := range medias {
+			// Liberar o arquivo se falhar ao salvar no banco
+			h.releaseFile(context.Background(), media)
+			if errors.Is(err, repository.ErrQuotaExceeded) {
+				results[stored[j]].Error = quotaError()
+				continue
+			}
+			results[stored[j]].Error = &models.UploadError{
+				Code:    "database_error",
+				Message: "Erro ao salvar no banco de dados",
+			}
+		}
+		medias = nil
+		batchDuplicates = nil
+	}
+
+	for j, media := range medias {
+		results[stored[j]].Media = media
+		h.processor.Enqueue(media.ID)
+	}
+	for _, pair := range batchDuplicates {
+		results[pair[0]].DuplicateOf = &medias[pair[1]].ID
+	}
+
+	uploaded := len(medias)
+	failed := len(results) - uploaded
+
+	status := http.StatusCreated
+	message := "Arquivos enviados com sucesso"
+	if aborted || incomplete {
+		// O corpo restante não será lido
+		c.Header("Connection", "close")
+	}
+	var batchErr *models.UploadError
+	if incomplete {
+		batchErr = &incompleteForm
+	}
+	switch {
+	case uploaded == 0 && aborted:
+		status = http.StatusRequestEntityTooLarge
+		message = "Nenhum arquivo foi enviado"
+	case uploaded == 0:
+		status = http.StatusBadRequest
+		message = "Nenhum arquivo foi enviado"
+	case incomplete:
+		status = http.StatusMultiStatus
+		message = "O formulário foi interrompido; apenas os arquivos recebidos por completo foram salvos"
+	case failed > 0:
+		status = http.StatusMultiStatus
+		message = "Alguns arquivos não puderam ser enviados"
+	}
+
+	c.JSON(status, models.MultiUploadResponse{
+		Results:  results,
+		Uploaded: uploaded,
+		Failed:   failed,
+		Error:    batchErr,
+		Message:  message,
+	})
+}
+
+// incompleteForm é o erro do envio quando o formulário multipart não chega
+// ao fim: a requisição foi interrompida ou o corpo está malformado
+var incompleteForm = models.UploadError{Code: "incomplete_form", Message: "Formulário incompleto ou malformado"}
+
+// nextFilePart avança o formulário até a próxima parte de arquivo no campo informado
+func nextFilePart(reader *multipart.Reader, field string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" && part.FormName() == field {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// sniffLength é a quantidade de bytes iniciais usada para detectar o tipo real do arquivo
+const sniffLength = 3072
+
+// storeFile valida e grava no armazenamento o conteúdo de um arquivo de mídia.
+// É o ponto de entrada comum para todos os tipos de upload; o registro no
+// banco de dados fica a cargo do chamador. size pode ser -1 quando o tamanho
+// não é conhecido antecipadamente: ele é contado durante a gravação.
+func (h *MediaHandler) storeFile(ctx context.Context, r io.Reader, size int64, originalName, declaredType string) (*models.Media, *models.UploadError) {
+	source := r
+
+	// Detectar o tipo real pelos bytes iniciais, sem confiar no Content-Type do cliente
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if errors.Is(err, errQuotaExceeded) {
+		return nil, quotaError()
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, &models.UploadError{Code: "read_error", Message: "Erro ao ler arquivo"}
+	}
+	head = head[:n]
+
+	contentType, uploadErr := h.detectContentType(head, declaredType)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
 
 	// Validar tipo de arquivo
-	contentType := header.Header.Get("Content-Type")
-	mediaType := h.getMediaType(contentType)
-	if mediaType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Tipo de arquivo não suportado. Apenas imagens e vídeos são permitidos",
-		})
-		return
+	mediaType, uploadErr := h.validateContentType(contentType)
+	if uploadErr != nil {
+		return nil, uploadErr
 	}
 
-	// Sem limitação de tamanho para vídeos grandes
+	// Aplicar o tamanho máximo do tipo durante a cópia: a gravação é
+	// interrompida assim que o limite é ultrapassado
+	if maxSize := h.maxSize(mediaType); maxSize > 0 {
+		if size > maxSize || int64(len(head)) > maxSize {
+			return nil, fileTooLarge(mediaType, maxSize)
+		}
+		r = &limitReader{r: r, remaining: maxSize - int64(len(head)), err: errFileTooLarge}
+	}
+	content := io.MultiReader(bytes.NewReader(head), r)
 
-	// Gerar nome único para o arquivo
-	fileExt := filepath.Ext(header.Filename)
-	fileName := uuid.New().String() + fileExt
+	// Arquivos já completos em disco (tus), de tamanho conhecido, são relidos
+	// do início: o armazenamento calcula o SHA-256 antes de gravar e evita a
+	// cópia pela chave temporária
+	if file, ok := source.(io.ReaderAt); ok && size >= 0 {
+		content = io.NewSectionReader(file, 0, size)
+	}
 
-	// Criar diretório por data
-	now := time.Now()
-	dateDir := now.Format("2006/01/02")
-	fullDir := filepath.Join(h.uploadPath, dateDir)
+	// Salvar arquivo endereçado pelo SHA-256 do conteúdo; conteúdos já
+	// armazenados não são gravados de novo
+	object, err := h.blobs.Put(ctx, content, size, contentType)
+	if errors.Is(err, errQuotaExceeded) {
+		return nil, quotaError()
+	}
+	if errors.Is(err, errFileTooLarge) {
+		return nil, fileTooLarge(mediaType, h.maxSize(mediaType))
+	}
+	if err != nil {
+		return nil, &models.UploadError{Code: "storage_error", Message: "Erro ao salvar arquivo"}
+	}
 
-	if err := os.MkdirAll(fullDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório"})
-		return
+	return &models.Media{
+		Filename:     newFileName(originalName),
+		OriginalName: originalName,
+		FilePath:     object.Key,
+		FileSize:     object.Size,
+		Checksum:     &object.Checksum,
+		MimeType:     contentType,
+		MediaType:    mediaType,
+	}, nil
+}
+
+// quotaExceeded é o erro informado quando o arquivo não cabe na cota do usuário
+var quotaExceeded = models.UploadError{Code: "quota_exceeded", Message: "Cota de armazenamento excedida"}
+
+func quotaError() *models.UploadError {
+	err := quotaExceeded
+	return &err
+}
+
+var (
+	// errQuotaExceeded interrompe a gravação de um arquivo maior que o espaço restante
+	errQuotaExceeded = errors.New("cota de armazenamento excedida")
+	// errFileTooLarge interrompe a gravação de um arquivo acima do tamanho máximo
+	errFileTooLarge = errors.New("arquivo acima do tamanho máximo")
+)
+
+// limitReader falha com err assim que o conteúdo lido ultrapassa remaining
+// bytes, interrompendo a gravação sem precisar conhecer o tamanho antecipadamente
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, l.err
+	}
+	return n, err
+}
+
+// limitQuota limita r ao espaço restante (-1 para sem limite)
+func limitQuota(r io.Reader, remaining int64) io.Reader {
+	if remaining < 0 {
+		return r
 	}
+	return &limitReader{r: r, remaining: remaining, err: errQuotaExceeded}
+}
 
-	// Caminho completo do arquivo
-	filePath := filepath.Join(fullDir, fileName)
+// fileTooLargeCode é o código de erro de arquivos acima do tamanho máximo
+const fileTooLargeCode = "file_too_large"
 
-	// Salvar arquivo
-	dst, err := os.Create(filePath)
+func fileTooLarge(mediaType models.MediaType, maxSize int64) *models.UploadError {
+	label := "imagens"
+	if mediaType == models.MediaTypeVideo {
+		label = "vídeos"
+	}
+	return &models.UploadError{
+		Code:    fileTooLargeCode,
+		Message: fmt.Sprintf("Arquivo maior que o tamanho máximo permitido para %s (%s)", label, formatSize(maxSize)),
+	}
+}
+
+// maxSize retorna o tamanho máximo configurado para o tipo (0 sem limite)
+func (h *MediaHandler) maxSize(mediaType models.MediaType) int64 {
+	switch mediaType {
+	case models.MediaTypeImage:
+		return h.cfg.MaxImageSize
+	case models.MediaTypeVideo:
+		return h.cfg.MaxVideoSize
+	}
+	return 0
+}
+
+// formatSize formata um tamanho em bytes para mensagens
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f %s", value, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// userQuota retorna a cota efetiva do usuário: a própria ou a padrão
+func (h *MediaHandler) userQuota(userID int) (models.Quota, error) {
+	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
-		return
+		return models.Quota{}, err
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
-		return
+	quota := h.defaultQuota()
+	if user.QuotaBytes != nil {
+		quota.Bytes = *user.QuotaBytes
+	}
+	if user.QuotaFiles != nil {
+		quota.Files = *user.QuotaFiles
 	}
+	return quota, nil
+}
 
-	// Salvar no banco de dados
-	media := &models.Media{
-		UserID:       userID,
-		Filename:     fileName,
-		OriginalName: header.Filename,
-		FilePath:     filepath.Join(dateDir, fileName),
-		FileSize:     header.Size,
-		MimeType:     contentType,
-		MediaType:    models.MediaType(mediaType),
+// defaultQuota é a cota dos usuários sem cota própria
+func (h *MediaHandler) defaultQuota() models.Quota {
+	return models.Quota{Bytes: h.cfg.DefaultQuotaBytes, Files: h.cfg.DefaultQuotaFiles}
+}
+
+// remainingQuota retorna quantos bytes e arquivos o usuário ainda pode
+// enviar; -1 indica sem limite
+func (h *MediaHandler) remainingQuota(userID int) (int64, int, error) {
+	quota, err := h.userQuota(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if quota.Bytes <= 0 && quota.Files <= 0 {
+		return -1, -1, nil
 	}
 
-	if err := h.mediaRepo.Create(media); err != nil {
-		// Remover arquivo se falhar ao salvar no banco
-		os.Remove(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar no banco de dados"})
-		return
+	usage, err := h.mediaRepo.GetUsage(userID)
+	if err != nil {
+		return 0, 0, err
 	}
+	bytes, files := quota.Remaining(usage)
+	return bytes, files, nil
+}
 
-	c.JSON(http.StatusCreated, models.UploadResponse{
-		Media:   *media,
-		Message: "Arquivo enviado com sucesso",
-	})
+// checkDuplicate procura uma mídia do usuário com o mesmo conteúdo. Quando
+// reject é verdadeiro o arquivo recém-gravado é liberado e o upload falha.
+func (h *MediaHandler) checkDuplicate(ctx context.Context, userID int, media *models.Media, reject bool) (*int, *models.UploadError) {
+	duplicateOf, err := h.mediaRepo.FindDuplicate(userID, *media.Checksum)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		h.releaseFile(context.Background(), media)
+		return nil, &models.UploadError{Code: "database_error", Message: "Erro ao verificar arquivos duplicados"}
+	}
+
+	if reject {
+		h.releaseFile(ctx, media)
+		return &duplicateOf, &models.UploadError{
+			Code:    "duplicate",
+			Message: fmt.Sprintf("Arquivo já enviado anteriormente (mídia %d)", duplicateOf),
+		}
+	}
+	return &duplicateOf, nil
+}
+
+// releaseFile libera a referência de uma mídia ao seu arquivo original.
+// Falhas são apenas registradas em log.
+func (h *MediaHandler) releaseFile(ctx context.Context, media *models.Media) {
+	if err := h.blobs.Release(ctx, media.FilePath, media.Checksum); err != nil {
+		log.Printf("Erro ao liberar arquivo %s: %v", media.FilePath, err)
+	}
+}
+
+// detectContentType identifica o tipo MIME pelo conteúdo e o compara com o
+// tipo declarado pelo cliente. Diferenças de subtipo dentro da mesma categoria
+// (ex.: video/mp4 declarado e video/x-m4v detectado) são aceitas e o tipo
+// detectado prevalece; já um arquivo declarado como imagem que não é imagem
+// (ou vice-versa) é rejeitado.
+func (h *MediaHandler) detectContentType(head []byte, declaredType string) (string, *models.UploadError) {
+	detected, _, _ := mime.ParseMediaType(mimetype.Detect(head).String())
+
+	declared, _, err := mime.ParseMediaType(declaredType)
+	if err != nil || declared == "application/octet-stream" {
+		// Sem tipo declarado útil: vale apenas o conteúdo
+		return detected, nil
+	}
+
+	if h.getMediaType(declared) != h.getMediaType(detected) {
+		return "", &models.UploadError{
+			Code:    "content_mismatch",
+			Message: fmt.Sprintf("O conteúdo do arquivo (%s) não corresponde ao tipo informado (%s)", detected, declared),
+		}
+	}
+
+	return detected, nil
+}
+
+// validateContentType verifica se o tipo é uma imagem ou vídeo permitido
+func (h *MediaHandler) validateContentType(contentType string) (models.MediaType, *models.UploadError) {
+	contentType = strings.ToLower(contentType)
+
+	var allowed []string
+	switch h.getMediaType(contentType) {
+	case "image":
+		allowed = h.cfg.AllowedImageTypes
+	case "video":
+		allowed = h.cfg.AllowedVideoTypes
+	default:
+		return "", &models.UploadError{
+			Code:    "unsupported_type",
+			Message: "Tipo de arquivo não suportado. Apenas imagens e vídeos são permitidos",
+		}
+	}
+
+	for _, allowedType := range allowed {
+		if strings.EqualFold(allowedType, contentType) {
+			return models.MediaType(h.getMediaType(contentType)), nil
+		}
+	}
+
+	return "", &models.UploadError{
+		Code:    "unsupported_type",
+		Message: fmt.Sprintf("Tipo de arquivo não permitido: %s", contentType),
+	}
+}
+
+// newFileName gera um nome único para o arquivo, preservando a extensão
+// original. O nome é usado apenas para exibição e download; a chave no
+// armazenamento é derivada do conteúdo.
+func newFileName(originalName string) string {
+	return uuid.New().String() + filepath.Ext(originalName)
 }
 
 // List lista arquivos com paginação
@@ -139,10 +591,11 @@ func (h *MediaHandler) List(c *gin.Context) {
 
 	// Filtros
 	mediaType := c.Query("type")
+	tag := c.Query("tag")
 	orderBy := c.DefaultQuery("order_by", "sort_order")
 
 	// Buscar dados
-	medias, total, err := h.mediaRepo.List(userID, page, pageSize, mediaType, orderBy)
+	medias, total, err := h.mediaRepo.List(readScope(c, userID), page, pageSize, mediaType, tag, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivos"})
 		return
@@ -179,10 +632,29 @@ func (h *MediaHandler) ListPublic(c *gin.Context) {
 
 	// Filtros
 	mediaType := c.Query("type")
+	tag := c.Query("tag")
 	orderBy := c.DefaultQuery("order_by", "sort_order")
 
+	// Validar o cache antes de montar a listagem: o ETag combina os
+	// parâmetros com a última alteração nas mídias públicas
+	count, lastChange, err := h.mediaRepo.LastPublicChange()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivos"})
+		return
+	}
+	etag := strongETag("gallery", strconv.Itoa(count), lastChange.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(page), strconv.Itoa(pageSize), mediaType, tag, orderBy)
+	c.Header("Cache-Control", galleryCacheControl)
+	c.Header("ETag", etag)
+	if !lastChange.IsZero() {
+		c.Header("Last-Modified", lastChange.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c, etag, lastChange) {
+		return
+	}
+
 	// Buscar dados publicamente
-	medias, total, err := h.mediaRepo.ListPublic(page, pageSize, mediaType, orderBy)
+	medias, total, err := h.mediaRepo.ListPublic(page, pageSize, mediaType, tag, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivos"})
 		return
@@ -217,7 +689,7 @@ func (h *MediaHandler) Get(c *gin.Context) {
 		return
 	}
 
-	media, err := h.mediaRepo.GetByID(id, userID)
+	media, err := h.mediaRepo.GetInScope(id, lookupScope(c, userID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
 		return
@@ -226,6 +698,32 @@ func (h *MediaHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, media)
 }
 
+// sharedVisibilities são as mídias de outros usuários listadas para os
+// viewers. Mídias não listadas nunca aparecem em listagens: são consultadas
+// apenas diretamente pelo ID (ver lookupScope).
+var sharedVisibilities = []models.Visibility{models.VisibilityPublic}
+
+// readScope define as mídias consultadas pelo usuário. Viewers não enviam
+// mídias: além das próprias, leem as públicas de todos os usuários.
+// Editores e administradores consultam apenas as próprias.
+func readScope(c *gin.Context, userID int) repository.MediaScope {
+	scope := repository.MediaScope{UserID: userID}
+	if role, _ := middleware.GetRole(c); role == models.RoleViewer {
+		scope.Shared = sharedVisibilities
+	}
+	return scope
+}
+
+// lookupScope é o escopo da consulta de uma mídia pelo ID: para viewers,
+// inclui também as mídias não listadas dos demais usuários
+func lookupScope(c *gin.Context, userID int) repository.MediaScope {
+	scope := readScope(c, userID)
+	if scope.Shared != nil {
+		scope.Shared = []models.Visibility{models.VisibilityPublic, models.VisibilityUnlisted}
+	}
+	return scope
+}
+
 // Update atualiza um arquivo
 func (h *MediaHandler) Update(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -257,12 +755,34 @@ func (h *MediaHandler) Update(c *gin.Context) {
 	if req.SortOrder != nil {
 		media.SortOrder = *req.SortOrder
 	}
+	if req.Visibility != nil {
+		media.Visibility = *req.Visibility
+	}
+	if req.Title != nil {
+		media.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Description != nil {
+		media.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.AltText != nil {
+		media.AltText = strings.TrimSpace(*req.AltText)
+	}
 
 	if err := h.mediaRepo.Update(media); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar arquivo"})
 		return
 	}
 
+	// Substituir o conjunto de tags quando informado
+	if req.Tags != nil {
+		tags, err := h.mediaRepo.SetTags(media.ID, *req.Tags)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar tags"})
+			return
+		}
+		media.Tags = tags
+	}
+
 	c.JSON(http.StatusOK, media)
 }
 
@@ -287,80 +807,311 @@ func (h *MediaHandler) Replace(c *gin.Context) {
 		return
 	}
 
-	// Parse multipart form
-	err = c.Request.ParseMultipartForm(1024 << 20) // 1GB max
+	// O arquivo atual vira versão e continua ocupando espaço; sem histórico
+	// o espaço dele é liberado pela substituição
+	remainingBytes, _, err := h.remainingQuota(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar cota"})
+		return
+	}
+	if remainingBytes >= 0 && h.cfg.MediaVersionRetention <= 0 {
+		remainingBytes += oldMedia.FileSize
+	}
+	if remainingBytes == 0 {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quotaExceeded.Message, "code": quotaExceeded.Code})
+		return
+	}
+
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao processar formulário"})
 		return
 	}
 
-	file, header, err := c.Request.FormFile("file")
+	part, err := nextFilePart(reader, "file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
 		return
 	}
-	defer file.Close()
+	defer part.Close()
+
+	// Salvar novo arquivo sob uma chave nova, que nenhum registro referencia
+	// ainda; o arquivo antigo não é tocado até o banco ser atualizado
+	media, uploadErr := h.storeFile(c.Request.Context(), limitQuota(part, remainingBytes), -1, part.FileName(), part.Header.Get("Content-Type"))
+	if uploadErr != nil {
+		status := http.StatusInternalServerError
+		switch uploadErr.Code {
+		case "unsupported_type", "content_mismatch":
+			status = http.StatusBadRequest
+		case quotaExceeded.Code, fileTooLargeCode:
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": uploadErr.Message, "code": uploadErr.Code})
+		return
+	}
 
-	// Validar tipo de arquivo
-	contentType := header.Header.Get("Content-Type")
-	mediaType := h.getMediaType(contentType)
-	if mediaType == "" {
+	// Atualizar todas as colunas de arquivo em uma transação
+	media.ID = oldMedia.ID
+	media.UserID = oldMedia.UserID
+	swap, err := h.mediaRepo.ReplaceFile(media, userID, h.cfg.MediaVersionRetention, h.defaultQuota())
+	if err != nil {
+		// Desfazer: o registro continua apontando para o arquivo antigo
+		h.releaseFile(context.Background(), media)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return
+		}
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quotaExceeded.Message, "code": quotaExceeded.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar banco de dados"})
+		return
+	}
+
+	// Somente após o commit remover os arquivos que deixaram de ser usados
+	// (derivados do arquivo antigo e versões além da retenção)
+	h.deleteKeys(context.Background(), oldMedia.ID, swap.Obsolete)
+	h.deleteDirs(context.Background(), oldMedia.ID, swap.ObsoleteDirs)
+	h.releaseRefs(context.Background(), oldMedia.ID, swap.Released)
+	h.processor.Enqueue(oldMedia.ID)
+
+	oldMedia.Filename = media.Filename
+	oldMedia.OriginalName = media.OriginalName
+	oldMedia.FilePath = media.FilePath
+	oldMedia.FileSize = media.FileSize
+	oldMedia.Checksum = media.Checksum
+	oldMedia.MimeType = media.MimeType
+	oldMedia.MediaType = media.MediaType
+	oldMedia.UpdatedAt = media.UpdatedAt
+	oldMedia.ProcessedAt = nil
+	oldMedia.Duration = nil
+	oldMedia.Width = nil
+	oldMedia.Height = nil
+	oldMedia.VideoCodec = nil
+	oldMedia.PosterPath = nil
+	oldMedia.Variants = []models.MediaVariant{}
+	oldMedia.Renditions = []models.MediaRendition{}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Media:   *oldMedia,
+		Message: "Arquivo substituído com sucesso",
+	})
+}
+
+// UploadPolicy retorna os tipos e tamanhos aceitos, para que os clientes
+// validem os arquivos antes de enviá-los
+func (h *MediaHandler) UploadPolicy(c *gin.Context) {
+	policy := models.UploadPolicy{
+		Image:             models.TypePolicy{AllowedTypes: h.cfg.AllowedImageTypes},
+		Video:             models.TypePolicy{AllowedTypes: h.cfg.AllowedVideoTypes},
+		DefaultVisibility: models.Visibility(h.cfg.DefaultVisibility),
+		RejectDuplicates:  h.cfg.RejectDuplicates,
+	}
+	if h.cfg.MaxImageSize > 0 {
+		policy.Image.MaxSize = &h.cfg.MaxImageSize
+	}
+	if h.cfg.MaxVideoSize > 0 {
+		policy.Video.MaxSize = &h.cfg.MaxVideoSize
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Usage retorna o espaço ocupado pelo usuário e sua cota
+func (h *MediaHandler) Usage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	quota, err := h.userQuota(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar cota"})
+		return
+	}
+
+	usage, err := h.mediaRepo.GetUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular uso"})
+		return
+	}
+
+	response := models.UsageResponse{Usage: *usage}
+	remainingBytes, remainingFiles := quota.Remaining(usage)
+	if quota.Bytes > 0 {
+		response.QuotaBytes = &quota.Bytes
+		response.RemainingBytes = &remainingBytes
+	}
+	if quota.Files > 0 {
+		response.QuotaFiles = &quota.Files
+		response.RemainingFiles = &remainingFiles
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Link gera uma URL assinada e com validade para um arquivo da mídia, que
+// pode ser usada sem o header Authorization mesmo em mídias privadas
+func (h *MediaHandler) Link(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	// O corpo é opcional
+	var req models.MediaLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	ttl := h.cfg.SignedURLTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > h.cfg.SignedURLMaxTTL {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Tipo de arquivo não suportado",
+			"error": fmt.Sprintf("Validade máxima de um link: %d segundos", int(h.cfg.SignedURLMaxTTL.Seconds())),
 		})
 		return
 	}
 
-	// Remover arquivo antigo
-	oldFilePath := filepath.Join(h.uploadPath, oldMedia.FilePath)
-	os.Remove(oldFilePath)
+	media, err := h.mediaRepo.GetInScope(id, readScope(c, userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
 
-	// Salvar novo arquivo
-	fileExt := filepath.Ext(header.Filename)
-	fileName := uuid.New().String() + fileExt
+	key := media.FilePath
+	switch req.Variant {
+	case "":
+	case "poster":
+		if media.PosterPath == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Poster não encontrado"})
+			return
+		}
+		key = *media.PosterPath
+	default:
+		key = ""
+		for _, variant := range media.Variants {
+			if variant.Name == req.Variant {
+				key = variant.FilePath
+				break
+			}
+		}
+		if key == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variante não encontrada"})
+			return
+		}
+	}
+
+	ip := ""
+	if req.BindIP {
+		ip = c.ClientIP()
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query := h.signer.Sign(key, expiresAt, ip)
+
+	c.JSON(http.StatusOK, models.MediaLinkResponse{
+		URL:       "/api/v1/files/" + key + "?" + query.Encode(),
+		FilePath:  key,
+		ExpiresAt: expiresAt,
+		Message:   "Link gerado com sucesso",
+	})
+}
+
+// ListVersions lista as versões anteriores de um arquivo
+func (h *MediaHandler) ListVersions(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
 
-	now := time.Now()
-	dateDir := now.Format("2006/01/02")
-	fullDir := filepath.Join(h.uploadPath, dateDir)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
 
-	if err := os.MkdirAll(fullDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório"})
+	if _, err := h.mediaRepo.GetInScope(id, readScope(c, userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
 		return
 	}
 
-	filePath := filepath.Join(fullDir, fileName)
-	dst, err := os.Create(filePath)
+	versions, err := h.mediaRepo.ListVersions(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar versões do arquivo"})
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
+	c.JSON(http.StatusOK, models.MediaVersionListResponse{
+		Data:    versions,
+		Total:   len(versions),
+		Message: "Versões listadas com sucesso",
+	})
+}
+
+// RestoreVersion torna uma versão anterior o arquivo atual. O arquivo atual
+// é guardado como versão.
+func (h *MediaHandler) RestoreVersion(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
 		return
 	}
 
-	// Atualizar no banco
-	oldMedia.Filename = fileName
-	oldMedia.OriginalName = header.Filename
-	oldMedia.FilePath = filepath.Join(dateDir, fileName)
-	oldMedia.FileSize = header.Size
-	oldMedia.MimeType = contentType
-	oldMedia.MediaType = models.MediaType(mediaType)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
 
-	if err := h.mediaRepo.Update(oldMedia); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar banco de dados"})
+	versionID, err := strconv.Atoi(c.Param("versionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de versão inválido"})
+		return
+	}
+
+	swap, err := h.mediaRepo.RestoreVersion(id, userID, versionID, userID, h.cfg.MediaVersionRetention)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Versão não encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao restaurar versão"})
+		return
+	}
+
+	h.deleteKeys(context.Background(), id, swap.Obsolete)
+	h.deleteDirs(context.Background(), id, swap.ObsoleteDirs)
+	h.releaseRefs(context.Background(), id, swap.Released)
+	h.processor.Enqueue(id)
+
+	media, err := h.mediaRepo.GetByID(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivo"})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.UploadResponse{
-		Media:   *oldMedia,
-		Message: "Arquivo substituído com sucesso",
+		Media:   *media,
+		Message: "Versão restaurada com sucesso",
 	})
 }
 
-// Delete exclui um arquivo
+// Delete move um arquivo para a lixeira. Ele é excluído definitivamente
+// após o período de retenção da lixeira.
 func (h *MediaHandler) Delete(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
 	if !exists {
@@ -374,24 +1125,87 @@ func (h *MediaHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// Buscar mídia
-	media, err := h.mediaRepo.GetByID(id, userID)
+	if err := h.mediaRepo.Trash(id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir arquivo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Arquivo movido para a lixeira"})
+}
+
+// ListTrash lista os arquivos na lixeira
+func (h *MediaHandler) ListTrash(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	// Parâmetros de paginação
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	// Validar parâmetros
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	medias, total, err := h.mediaRepo.ListTrash(userID, page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar lixeira"})
 		return
 	}
 
-	// Remover arquivo físico
-	filePath := filepath.Join(h.uploadPath, media.FilePath)
-	os.Remove(filePath)
+	c.JSON(http.StatusOK, models.MediaListResponse{
+		Data:       medias,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int(math.Ceil(float64(total) / float64(pageSize))),
+		Message:    "Lixeira listada com sucesso",
+	})
+}
 
-	// Remover do banco
-	if err := h.mediaRepo.Delete(id, userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir arquivo"})
+// Restore retira um arquivo da lixeira
+func (h *MediaHandler) Restore(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Arquivo excluído com sucesso"})
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := h.mediaRepo.Restore(id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado na lixeira"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao restaurar arquivo"})
+		return
+	}
+
+	media, err := h.mediaRepo.GetByID(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Media:   *media,
+		Message: "Arquivo restaurado com sucesso",
+	})
 }
 
 // UpdateSortOrder atualiza a ordem dos arquivos
@@ -421,18 +1235,269 @@ func (h *MediaHandler) UpdateSortOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Ordem atualizada com sucesso"})
 }
 
-// Serve serve arquivos estáticos
+// Serve serve arquivos armazenados. Arquivos de mídias privadas só são
+// entregues ao dono autenticado; para os demais a resposta é 404, sem
+// revelar que o arquivo existe.
 func (h *MediaHandler) Serve(c *gin.Context) {
-	filePath := c.Param("filepath")
-	fullPath := filepath.Join(h.uploadPath, filePath)
+	key := storage.CleanKey(c.Param("filepath"))
+
+	// Apenas arquivos que pertencem a uma mídia são servidos
+	owners, err := h.mediaRepo.ListFileOwners(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivo"})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	mimeType, allowed, public := fileAccess(owners, userID)
+
+	// Arquivos privados também podem ser acessados com uma URL assinada: para
+	// o próprio arquivo ou, nas rendições HLS, para o diretório da rendição
+	var signedUntil time.Time
+	var renditionSigned bool
+	if !allowed && len(owners) > 0 && c.Query(auth.ParamSignature) != "" {
+		query := c.Request.URL.Query()
+		err := h.signer.Verify(key, query, c.ClientIP(), time.Now())
+		if errors.Is(err, auth.ErrInvalidSignature) {
+			if err = h.signer.Verify(renditionScope(key), query, c.ClientIP(), time.Now()); err == nil {
+				renditionSigned = true
+			}
+		}
+		switch {
+		case err == nil:
+			allowed = true
+			signedUntil = auth.SignatureExpiry(query)
+		case errors.Is(err, auth.ErrSignatureExpired):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Link expirado"})
+			return
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Assinatura inválida"})
+			return
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+	if renditionSigned && path.Ext(key) == ".m3u8" {
+		h.serveSignedPlaylist(c, key, signedUntil)
+		return
+	}
+
+	// A visibilidade da mídia pode mudar e a URL assinada vence: o tempo de
+	// cache é limitado por fileCacheControl. Arquivos entregues apenas ao
+	// dono não podem ser guardados por caches compartilhados.
+	checksum, isBlob := storage.ParseBlobKey(key)
+	cacheHeaders := func(etag string, modTime time.Time) {
+		c.Header("Cache-Control", fileCacheControl(public, isBlob, signedUntil, time.Now()))
+		if !public {
+			c.Header("Vary", "Authorization")
+		}
+		c.Header("ETag", etag)
+		if !modTime.IsZero() {
+			c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	// Em blobs o ETag é o próprio SHA-256: a revalidação dispensa ler o arquivo
+	if isBlob && c.GetHeader("If-None-Match") != "" {
+		if etag := `"` + checksum + `"`; etagMatches(c.GetHeader("If-None-Match"), etag) {
+			cacheHeaders(etag, time.Time{})
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	info, err := h.storage.Stat(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+
+	etag := strongETag(key, strconv.FormatInt(info.Size, 10), strconv.FormatInt(info.ModTime.UnixNano(), 10))
+	if isBlob {
+		etag = `"` + checksum + `"`
+	}
+	cacheHeaders(etag, info.ModTime)
+	if notModified(c, etag, info.ModTime) {
+		return
+	}
+
+	// Blobs não têm extensão: sem tipo registrado no armazenamento, usar o da mídia
+	if info.ContentType == "" {
+		info.ContentType = mimeType
+	}
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+
+	// Requisições parciais (Range, If-Range e múltiplos intervalos) são
+	// tratadas pelo ServeContent; o leitor busca no armazenamento apenas os
+	// trechos pedidos, em qualquer backend
+	reader := storage.NewRangeReader(c.Request.Context(), h.storage, key, info.Size)
+	defer reader.Close()
+
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, reader)
+}
 
-	// Verificar se arquivo existe
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+// serveSignedPlaylist entrega a playlist de uma rendição acessada com a
+// assinatura do diretório, repetindo a assinatura na URI de cada segmento:
+// URIs relativas não herdam a query da playlist
+func (h *MediaHandler) serveSignedPlaylist(c *gin.Context, key string, signedUntil time.Time) {
+	reader, _, err := h.storage.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+
+	signature := url.Values{}
+	for _, param := range []string{auth.ParamExpires, auth.ParamBind, auth.ParamSignature} {
+		if value := c.Query(param); value != "" {
+			signature.Set(param, value)
+		}
+	}
+
+	// As playlists geradas pelo ffmpeg têm apenas tags e URIs de segmentos
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if uri := strings.TrimSpace(line); uri != "" && !strings.HasPrefix(uri, "#") {
+			lines[i] = uri + "?" + signature.Encode()
+		}
+	}
+
+	c.Header("Cache-Control", fileCacheControl(false, false, signedUntil, time.Now()))
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(strings.Join(lines, "\n")))
+}
+
+// renditionScope é a chave assinada nas URLs das rendições HLS privadas: o
+// diretório da rendição, que dá acesso à playlist e aos segmentos. Chaves
+// de arquivos nunca terminam em "/", então as assinaturas não se confundem.
+func renditionScope(key string) string {
+	return path.Dir(key) + "/"
+}
+
+// Stream retorna a playlist master HLS de um vídeo, com uma entrada por
+// rendição. As playlists das rendições e os segmentos são servidos por Serve;
+// nos vídeos privados, as entradas levam uma assinatura do diretório de cada
+// rendição, já que players não enviam o header Authorization.
+func (h *MediaHandler) Stream(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	media, err := h.mediaRepo.FindActiveByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar arquivo"})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	public := media.Visibility != models.VisibilityPrivate
+	if !public && media.UserID != userID {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo não encontrado"})
 		return
 	}
+	if len(media.Renditions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream ainda não disponível para esta mídia"})
+		return
+	}
+
+	expiresAt := time.Now().Add(h.cfg.SignedURLTTL).Truncate(time.Second)
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, rendition := range media.Renditions {
+		uri := "/api/v1/files/" + rendition.PlaylistPath
+		if !public {
+			uri += "?" + h.signer.Sign(renditionScope(rendition.PlaylistPath), expiresAt, "").Encode()
+		}
+		fmt.Fprintf(&playlist, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\"\n%s\n",
+			rendition.Bandwidth, rendition.Width, rendition.Height, rendition.Name, uri)
+	}
+
+	// A playlist muda quando o vídeo é reempacotado: exigir revalidação
+	etag := strongETag(playlist.String())
+	if public {
+		c.Header("Cache-Control", galleryCacheControl)
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+		c.Header("Vary", "Authorization")
+	}
+	c.Header("ETag", etag)
+	if notModified(c, etag, time.Time{}) {
+		return
+	}
 
-	c.File(fullPath)
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist.String()))
+}
+
+// fileAccess decide se o arquivo pode ser entregue ao usuário (0 quando
+// anônimo). Um mesmo arquivo pode pertencer a várias mídias: ele é liberado
+// se alguma delas não for privada ou se pertencer ao usuário. Retorna também
+// o tipo MIME registrado para o arquivo, quando houver, e se o arquivo é
+// acessível a qualquer pessoa.
+func fileAccess(owners []repository.FileOwner, userID int) (mimeType string, allowed, public bool) {
+	for _, owner := range owners {
+		if owner.Visibility != models.VisibilityPrivate {
+			allowed, public = true, true
+		} else if userID != 0 && owner.UserID == userID {
+			allowed = true
+		}
+		if mimeType == "" {
+			mimeType = owner.MimeType
+		}
+	}
+	return mimeType, allowed, public
+}
+
+// deleteKeys remove arquivos do armazenamento. Falhas são apenas registradas em log.
+func (h *MediaHandler) deleteKeys(ctx context.Context, mediaID int, keys []string) {
+	for _, key := range keys {
+		if err := h.storage.Delete(ctx, key); err != nil {
+			log.Printf("Erro ao remover arquivo %s da mídia %d: %v", key, mediaID, err)
+		}
+	}
+}
+
+// deleteDirs remove diretórios inteiros do armazenamento (rendições HLS).
+// Falhas são apenas registradas em log.
+func (h *MediaHandler) deleteDirs(ctx context.Context, mediaID int, prefixes []string) {
+	for _, prefix := range prefixes {
+		if err := storage.DeletePrefix(ctx, h.storage, prefix); err != nil {
+			log.Printf("Erro ao remover diretório %s da mídia %d: %v", prefix, mediaID, err)
+		}
+	}
+}
+
+// releaseRefs libera as referências a arquivos originais que deixaram de ser
+// usados. Falhas são apenas registradas em log.
+func (h *MediaHandler) releaseRefs(ctx context.Context, mediaID int, refs []repository.FileRef) {
+	for _, ref := range refs {
+		if err := h.blobs.Release(ctx, ref.FilePath, ref.Checksum); err != nil {
+			log.Printf("Erro ao liberar arquivo %s da mídia %d: %v", ref.FilePath, mediaID, err)
+		}
+	}
 }
 
 // getMediaType determina o tipo de mídia baseado no content-type
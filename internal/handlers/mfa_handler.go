@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/config"
+	"multi-upload-api/internal/middleware"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recoveryCodeCount é a quantidade de códigos de recuperação gerados
+const recoveryCodeCount = 10
+
+// maxMFAFailures é a quantidade de códigos inválidos seguidos, somadas todas
+// as rotas, que bloqueia a conferência de códigos do usuário por mfaLockout
+const (
+	maxMFAFailures = 10
+	mfaLockout     = 15 * time.Minute
+)
+
+// MFAHandler gerencia a autenticação em dois fatores (TOTP): a configuração
+// pelo próprio usuário e a política e o reset pelos administradores
+type MFAHandler struct {
+	userRepo  *repository.UserRepository
+	mfaRepo   *repository.MFARepository
+	tokenRepo *repository.TokenRepository
+	cfg       *config.Config
+}
+
+func NewMFAHandler(userRepo *repository.UserRepository, mfaRepo *repository.MFARepository, tokenRepo *repository.TokenRepository, cfg *config.Config) *MFAHandler {
+	return &MFAHandler{
+		userRepo:  userRepo,
+		mfaRepo:   mfaRepo,
+		tokenRepo: tokenRepo,
+		cfg:       cfg,
+	}
+}
+
+// Status informa se a autenticação em dois fatores está ativa, se é
+// obrigatória para o papel do usuário e quantos códigos de recuperação restam
+func (h *MFAHandler) Status(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	required, err := h.mfaRepo.IsRequired(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar política de autenticação"})
+		return
+	}
+
+	remaining := 0
+	if user.MFAEnabledAt != nil {
+		if remaining, err = h.mfaRepo.CountRecoveryCodes(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao contar códigos de recuperação"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.MFAEnabledAt != nil,
+		"enabled_at":               user.MFAEnabledAt,
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Setup gera um novo segredo TOTP e retorna a URI para o QR code. O segredo
+// só passa a ser exigido depois de confirmado em Enable.
+func (h *MFAHandler) Setup(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A autenticação em dois fatores já está ativa"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err == nil {
+		err = h.mfaRepo.SetPendingSecret(user.ID, secret)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar segredo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFASetupResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(h.cfg.MFAIssuer, user.Username, secret),
+	})
+}
+
+// Enable confirma o segredo gerado em Setup com um código do aplicativo
+// autenticador, ativa a autenticação em dois fatores e retorna os códigos de
+// recuperação
+func (h *MFAHandler) Enable(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A autenticação em dois fatores já está ativa"})
+		return
+	}
+	if user.TOTPSecret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gere o segredo em /me/mfa/setup antes de ativar"})
+		return
+	}
+
+	var step int64
+	valid, err := attemptSecondFactor(h.mfaRepo, user.ID, func() (bool, error) {
+		var valid bool
+		step, valid = auth.ValidateTOTP(*user.TOTPSecret, strings.TrimSpace(req.Code), time.Now())
+		return valid, nil
+	})
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código inválido"})
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err == nil {
+		err = h.mfaRepo.Enable(user.ID, step, hashes)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao ativar autenticação em dois fatores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Autenticação em dois fatores ativada. Guarde os códigos de recuperação: eles não serão mostrados novamente",
+	})
+}
+
+// Disable desativa a autenticação em dois fatores do próprio usuário, com a
+// senha e um código. Não é permitido quando ela é obrigatória para o papel.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req models.MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A autenticação em dois fatores não está ativa"})
+		return
+	}
+
+	required, err := h.mfaRepo.IsRequired(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar política de autenticação"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "A autenticação em dois fatores é obrigatória para o seu papel"})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Senha incorreta"})
+		return
+	}
+	if !h.checkCode(c, user, req.Code) {
+		return
+	}
+
+	if err := h.mfaRepo.Disable(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao desativar autenticação em dois fatores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores desativada"})
+}
+
+// RegenerateRecoveryCodes substitui os códigos de recuperação, confirmando a
+// operação com um código
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A autenticação em dois fatores não está ativa"})
+		return
+	}
+	if !h.checkCode(c, user, req.Code) {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err == nil {
+		err = h.mfaRepo.ReplaceRecoveryCodes(user.ID, hashes)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar códigos de recuperação"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Códigos de recuperação gerados. Os anteriores deixaram de valer",
+	})
+}
+
+// GetPolicy retorna os papéis para os quais a autenticação em dois fatores é
+// obrigatória
+func (h *MFAHandler) GetPolicy(c *gin.Context) {
+	roles, err := h.mfaRepo.RequiredRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar política de autenticação"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAPolicy{RequiredRoles: roles})
+}
+
+// UpdatePolicy define os papéis para os quais a autenticação em dois fatores
+// é obrigatória. Vale a partir do próximo login ou renovação de token.
+func (h *MFAHandler) UpdatePolicy(c *gin.Context) {
+	var req models.MFAPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	for _, role := range req.RequiredRoles {
+		if !role.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Papel inválido: %q (use admin, editor ou viewer)", role)})
+			return
+		}
+	}
+
+	if err := h.mfaRepo.SetRequiredRoles(req.RequiredRoles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar política de autenticação"})
+		return
+	}
+
+	h.GetPolicy(c)
+}
+
+// ResetUser remove a autenticação em dois fatores de um usuário que perdeu o
+// aplicativo autenticador e os códigos de recuperação, e encerra suas sessões
+func (h *MFAHandler) ResetUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := h.mfaRepo.Disable(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover autenticação em dois fatores"})
+		return
+	}
+	if err := h.tokenRepo.RevokeUserSessions(id); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %d: %v", id, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores removida"})
+}
+
+// currentUser busca o usuário autenticado
+func (h *MFAHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuário"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkCode confere um código TOTP ou de recuperação, respondendo com erro
+// quando ele não é válido
+func (h *MFAHandler) checkCode(c *gin.Context, user *models.User, code string) bool {
+	valid, err := verifySecondFactor(h.mfaRepo, user, code)
+	if err != nil {
+		respondCodeError(c, err)
+		return false
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código inválido"})
+		return false
+	}
+	return true
+}
+
+// respondCodeError responde a uma falha na conferência de um código
+func respondCodeError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrMFALocked) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitos códigos inválidos; tente novamente mais tarde"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar código"})
+}
+
+// verifySecondFactor confere um código TOTP (6 dígitos) ou de recuperação do
+// usuário. Cada código só é aceito uma vez.
+func verifySecondFactor(mfaRepo *repository.MFARepository, user *models.User, code string) (bool, error) {
+	if user.TOTPSecret == nil || user.MFAEnabledAt == nil {
+		return false, nil
+	}
+
+	return attemptSecondFactor(mfaRepo, user.ID, func() (bool, error) {
+		code := strings.TrimSpace(code)
+		if auth.IsTOTPCode(code) {
+			step, valid := auth.ValidateTOTP(*user.TOTPSecret, code, time.Now())
+			if !valid {
+				return false, nil
+			}
+			return mfaRepo.UseTOTPStep(user.ID, step)
+		}
+
+		return mfaRepo.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code))
+	})
+}
+
+// attemptSecondFactor conta a tentativa de código do usuário antes de
+// conferi-lo com check, retornando repository.ErrMFALocked durante o
+// bloqueio, e zera as falhas quando o código é aceito
+func attemptSecondFactor(mfaRepo *repository.MFARepository, userID int, check func() (bool, error)) (bool, error) {
+	if err := mfaRepo.AttemptCode(userID, maxMFAFailures, mfaLockout); err != nil {
+		return false, err
+	}
+
+	valid, err := check()
+	if err != nil || !valid {
+		return false, err
+	}
+	return true, mfaRepo.ResetFailures(userID)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/config"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordHandler gerencia a recuperação de senha pelo próprio usuário
+type PasswordHandler struct {
+	userRepo     *repository.UserRepository
+	tokenRepo    *repository.TokenRepository
+	emailService *services.EmailService
+	cfg          *config.Config
+}
+
+func NewPasswordHandler(userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, emailService *services.EmailService, cfg *config.Config) *PasswordHandler {
+	return &PasswordHandler{
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		emailService: emailService,
+		cfg:          cfg,
+	}
+}
+
+// Forgot envia por e-mail um token de redefinição de senha. A resposta é
+// sempre a mesma, e o envio acontece em segundo plano, para que não seja
+// possível descobrir quais e-mails estão cadastrados.
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	go h.sendResetToken(req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Se o e-mail estiver cadastrado, você receberá as instruções para redefinir a senha",
+	})
+}
+
+// sendResetToken gera e envia o token para o usuário do e-mail, se ele
+// existir e estiver ativo e não tiver recebido um token há menos de
+// PasswordResetCooldown. Erros são apenas registrados em log.
+func (h *PasswordHandler) sendResetToken(email string) {
+	user, err := h.userRepo.GetByEmail(email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Erro ao buscar usuário para redefinição de senha: %v", err)
+		}
+		return
+	}
+	if user.DisabledAt != nil || user.Email == nil {
+		return
+	}
+
+	token, hash, err := auth.GeneratePasswordResetToken()
+	if err != nil {
+		log.Printf("Erro ao gerar token de redefinição de senha: %v", err)
+		return
+	}
+	err = h.tokenRepo.CreatePasswordReset(user.ID, hash, time.Now().Add(h.cfg.PasswordResetTTL), h.cfg.PasswordResetCooldown)
+	if errors.Is(err, repository.ErrResetCooldown) {
+		// O token enviado há pouco continua valendo: não enviar outro e-mail
+		return
+	}
+	if err != nil {
+		log.Printf("Erro ao salvar token de redefinição de senha do usuário %d: %v", user.ID, err)
+		return
+	}
+
+	if err := h.emailService.SendPasswordResetEmail(*user.Email, user.Username, token, h.cfg.PasswordResetTTL); err != nil {
+		log.Printf("Erro ao enviar e-mail de redefinição de senha ao usuário %d: %v", user.ID, err)
+	}
+}
+
+// Reset redefine a senha com um token recebido por e-mail. O token só pode
+// ser usado uma vez, e todas as sessões do usuário são encerradas.
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := user.HashPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao criptografar senha",
+		})
+		return
+	}
+
+	userID, err := h.tokenRepo.ConsumePasswordReset(auth.HashPasswordResetToken(req.Token), user.Password)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Token inválido ou expirado",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao redefinir senha",
+		})
+		return
+	}
+
+	if err := h.tokenRepo.RevokeUserSessions(userID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Senha redefinida com sucesso",
+	})
+}
@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"multi-upload-api/internal/middleware"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+)
+
+// TusHandler implementa uploads resumíveis seguindo o protocolo tus 1.0
+// (core, creation, termination e expiration). Os bytes recebidos são
+// acumulados em um arquivo parcial em dir e, ao final, o arquivo passa pela
+// mesma validação e gravação do upload comum. Uploads sem atividade por ttl
+// expiram e são removidos por processing.UploadSweeper.
+type TusHandler struct {
+	uploadRepo *repository.UploadRepository
+	media      *MediaHandler
+	dir        string
+	ttl        time.Duration
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func NewTusHandler(uploadRepo *repository.UploadRepository, media *MediaHandler, dir string, ttl time.Duration) *TusHandler {
+	return &TusHandler{
+		uploadRepo: uploadRepo,
+		media:      media,
+		dir:        dir,
+		ttl:        ttl,
+		active:     make(map[string]bool),
+	}
+}
+
+// Options informa as capacidades do servidor tus
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if maxSize := h.maxSize(""); maxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Create inicia um novo upload resumível (extensão creation)
+func (h *TusHandler) Create(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length inválido"})
+		return
+	}
+
+	rawMetadata := c.GetHeader("Upload-Metadata")
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Metadata inválido"})
+		return
+	}
+
+	filename := firstNonEmpty(metadata["filename"], metadata["name"])
+	contentType := firstNonEmpty(metadata["filetype"], metadata["type"])
+
+	if visibility, ok := metadata["visibility"]; ok && !models.Visibility(visibility).Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibilidade inválida"})
+		return
+	}
+
+	// O tamanho é conhecido: verificar a cota antes de receber qualquer byte
+	remainingBytes, remainingFiles, err := h.media.remainingQuota(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar cota"})
+		return
+	}
+	if remainingFiles == 0 || (remainingBytes >= 0 && length > remainingBytes) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quotaExceeded.Message, "code": quotaExceeded.Code})
+		return
+	}
+
+	// Rejeitar antecipadamente tipos que seriam recusados ao final do upload;
+	// o tipo real ainda é verificado pelo conteúdo quando o arquivo termina
+	var mediaType models.MediaType
+	if contentType != "" {
+		var uploadErr *models.UploadError
+		if mediaType, uploadErr = h.media.validateContentType(contentType); uploadErr != nil {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": uploadErr.Message})
+			return
+		}
+	}
+	if maxSize := h.maxSize(mediaType); maxSize > 0 && length > maxSize {
+		uploadErr := fileTooLarge(mediaType, maxSize)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": uploadErr.Message, "code": uploadErr.Code})
+		return
+	}
+
+	upload := &models.Upload{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Length:      length,
+		Metadata:    rawMetadata,
+		Filename:    filename,
+		ContentType: contentType,
+	}
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório"})
+		return
+	}
+
+	file, err := os.Create(h.partPath(upload.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar arquivo"})
+		return
+	}
+	file.Close()
+
+	if err := h.uploadRepo.Create(upload); err != nil {
+		os.Remove(h.partPath(upload.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar no banco de dados"})
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	h.setExpires(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// Head retorna o progresso atual de um upload
+func (h *TusHandler) Head(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	if upload.MediaID != nil {
+		c.Header("X-Media-Id", strconv.Itoa(*upload.MediaID))
+	}
+	h.setExpires(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// Patch anexa bytes ao upload a partir do offset informado pelo cliente
+func (h *TusHandler) Patch(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type deve ser application/offset+octet-stream"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset inválido"})
+		return
+	}
+
+	// Apenas uma requisição por vez pode escrever em um mesmo upload. O
+	// registro é lido depois de obtida a trava, para que o offset conferido
+	// seja o atual.
+	if !h.lock(c.Param("uploadId")) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload em andamento em outra requisição"})
+		return
+	}
+	defer h.unlock(c.Param("uploadId"))
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset não corresponde ao offset atual"})
+		return
+	}
+	if upload.MediaID != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Upload já concluído"})
+		return
+	}
+
+	written, writeErr := h.appendChunk(upload, c.Request.Body)
+
+	// Persistir o progresso mesmo que a conexão tenha caído no meio do envio.
+	// O avanço só é gravado se o offset ainda for o lido: outra instância da
+	// API pode ter recebido o mesmo trecho ao mesmo tempo. O offset final só é
+	// gravado junto com a mídia (CreateFromUpload): até lá o upload fica um
+	// byte antes do fim, para que o cliente possa reenviar o último byte e
+	// repetir a conclusão se ela falhar.
+	persisted := upload.Offset + written
+	if persisted == upload.Length && upload.Length > 0 {
+		persisted--
+	}
+	if err := h.uploadRepo.AdvanceOffset(upload.ID, upload.Offset, persisted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset não corresponde ao offset atual"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar progresso"})
+		return
+	}
+	upload.Offset += written
+	upload.UpdatedAt = time.Now()
+	if writeErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gravar dados do upload"})
+		return
+	}
+
+	if upload.Completed() {
+		media, uploadErr := h.finish(c, upload)
+		if uploadErr != nil {
+			// Recusas definitivas descartam o upload; nas demais (falhas de
+			// armazenamento ou de banco) o offset gravado é o do último byte,
+			// e o cliente retoma pelo HEAD, reenviando-o
+			status := http.StatusInternalServerError
+			terminal := true
+			switch uploadErr.Code {
+			case "unsupported_type", "content_mismatch":
+				status = http.StatusUnsupportedMediaType
+			case "duplicate":
+				status = http.StatusConflict
+			case quotaExceeded.Code, fileTooLargeCode:
+				status = http.StatusRequestEntityTooLarge
+			case "upload_finished":
+				status = http.StatusForbidden
+				terminal = false
+			default:
+				terminal = false
+			}
+			if terminal {
+				h.discard(upload)
+			}
+			c.JSON(status, gin.H{"error": uploadErr.Message, "code": uploadErr.Code})
+			return
+		}
+		c.Header("X-Media-Id", strconv.Itoa(media.ID))
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.setExpires(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// Delete cancela um upload e descarta os bytes recebidos (extensão termination)
+func (h *TusHandler) Delete(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if !h.lock(c.Param("uploadId")) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload em andamento em outra requisição"})
+		return
+	}
+	defer h.unlock(c.Param("uploadId"))
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	os.Remove(h.partPath(upload.ID))
+
+	if err := h.uploadRepo.Delete(upload.ID, upload.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir upload"})
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// appendChunk grava no arquivo parcial no máximo os bytes que faltam para
+// completar o upload, retornando quantos foram gravados com segurança
+func (h *TusHandler) appendChunk(upload *models.Upload, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(h.partPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	dst := &chunkWriter{w: file}
+	written, _ := io.Copy(dst, io.LimitReader(body, upload.Length-upload.Offset))
+	if dst.err != nil {
+		return written, dst.err
+	}
+
+	// Uma falha na leitura do corpo (conexão interrompida) não é um erro do
+	// servidor: os bytes já gravados ficam disponíveis para o cliente retomar
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
+
+// chunkWriter guarda o erro de escrita para diferenciá-lo de erros de leitura
+type chunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	if err != nil {
+		cw.err = err
+	}
+	return n, err
+}
+
+// finish valida o arquivo montado e cria o registro de mídia
+func (h *TusHandler) finish(c *gin.Context, upload *models.Upload) (*models.Media, *models.UploadError) {
+	partPath := h.partPath(upload.ID)
+
+	// Verificar a cota de novo: outros envios podem ter terminado desde a criação
+	remainingBytes, remainingFiles, err := h.media.remainingQuota(upload.UserID)
+	if err != nil {
+		return nil, &models.UploadError{Code: "database_error", Message: "Erro ao verificar cota"}
+	}
+	if remainingFiles == 0 || (remainingBytes >= 0 && upload.Length > remainingBytes) {
+		return nil, quotaError()
+	}
+
+	file, err := os.Open(partPath)
+	if err != nil {
+		return nil, &models.UploadError{Code: "read_error", Message: "Erro ao ler arquivo"}
+	}
+	defer file.Close()
+
+	media, uploadErr := h.media.storeFile(c.Request.Context(), file, upload.Length, upload.Filename, upload.ContentType)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	media.UserID = upload.UserID
+	media.Visibility = models.Visibility(h.media.cfg.DefaultVisibility)
+	rejectDuplicates := h.media.cfg.RejectDuplicates
+	if metadata, err := parseTusMetadata(upload.Metadata); err == nil {
+		if metadata["visibility"] != "" {
+			media.Visibility = models.Visibility(metadata["visibility"])
+		}
+		switch metadata["on_duplicate"] {
+		case "reject":
+			rejectDuplicates = true
+		case "allow":
+			rejectDuplicates = false
+		}
+	}
+
+	duplicateOf, uploadErr := h.media.checkDuplicate(c.Request.Context(), upload.UserID, media, rejectDuplicates)
+	if duplicateOf != nil {
+		c.Header("X-Duplicate-Of", strconv.Itoa(*duplicateOf))
+	}
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	// A mídia e o vínculo com o upload são gravados juntos: um PATCH repetido
+	// após uma falha nunca cria uma segunda mídia
+	if err := h.media.mediaRepo.CreateFromUpload(media, upload.ID, h.media.defaultQuota()); err != nil {
+		h.media.releaseFile(context.Background(), media)
+		if errors.Is(err, repository.ErrUploadFinished) {
+			return nil, &models.UploadError{Code: "upload_finished", Message: "Upload já concluído"}
+		}
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			return nil, quotaError()
+		}
+		return nil, &models.UploadError{Code: "database_error", Message: "Erro ao salvar no banco de dados"}
+	}
+	upload.MediaID = &media.ID
+	h.media.processor.Enqueue(media.ID)
+
+	file.Close()
+	os.Remove(partPath)
+
+	return media, nil
+}
+
+// loadUpload busca o upload indicado na URL, respondendo com erro se não existir
+func (h *TusHandler) loadUpload(c *gin.Context) (*models.Upload, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+		return nil, false
+	}
+
+	upload, err := h.uploadRepo.GetByID(c.Param("uploadId"), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload não encontrado"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar upload"})
+		return nil, false
+	}
+
+	if upload.MediaID == nil && time.Now().After(upload.ExpiresAt(h.ttl)) {
+		h.discard(upload)
+		c.JSON(http.StatusGone, gin.H{"error": "Upload expirado"})
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// discard remove o arquivo parcial e o registro de um upload que não pode
+// mais ser concluído. Falhas são apenas registradas em log.
+func (h *TusHandler) discard(upload *models.Upload) {
+	if err := os.Remove(h.partPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Erro ao remover arquivo parcial do upload %s: %v", upload.ID, err)
+	}
+	if err := h.uploadRepo.Delete(upload.ID, upload.UserID); err != nil {
+		log.Printf("Erro ao excluir upload %s: %v", upload.ID, err)
+	}
+}
+
+// setExpires informa quando um upload ainda não concluído expira
+func (h *TusHandler) setExpires(c *gin.Context, upload *models.Upload) {
+	if upload.MediaID == nil {
+		c.Header("Upload-Expires", upload.ExpiresAt(h.ttl).UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkVersion garante que o cliente fala a mesma versão do protocolo
+func (h *TusHandler) checkVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Versão do protocolo tus não suportada"})
+		return false
+	}
+	return true
+}
+
+func (h *TusHandler) lock(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.active[id] {
+		return false
+	}
+	h.active[id] = true
+	return true
+}
+
+func (h *TusHandler) unlock(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.active, id)
+}
+
+// maxSize retorna o tamanho máximo de um upload do tipo informado. Sem tipo
+// declarado vale o maior dos limites, pois o tipo real só é conhecido ao
+// final; 0 significa sem limite.
+func (h *TusHandler) maxSize(mediaType models.MediaType) int64 {
+	if mediaType != "" {
+		return h.media.maxSize(mediaType)
+	}
+
+	imageMax := h.media.maxSize(models.MediaTypeImage)
+	videoMax := h.media.maxSize(models.MediaTypeVideo)
+	if imageMax <= 0 || videoMax <= 0 {
+		return 0
+	}
+	return max(imageMax, videoMax)
+}
+
+func (h *TusHandler) partPath(id string) string {
+	return filepath.Join(h.dir, id)
+}
+
+// parseTusMetadata decodifica o header Upload-Metadata ("chave base64,chave base64")
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("valor inválido para %s: %w", parts[0], err)
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("par inválido: %q", pair)
+		}
+	}
+
+	return metadata, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserHandler gerencia as contas de usuário. Todas as rotas são restritas a
+// administradores.
+type UserHandler struct {
+	userRepo  *repository.UserRepository
+	mediaRepo *repository.MediaRepository
+	tokenRepo *repository.TokenRepository
+}
+
+func NewUserHandler(userRepo *repository.UserRepository, mediaRepo *repository.MediaRepository, tokenRepo *repository.TokenRepository) *UserHandler {
+	return &UserHandler{
+		userRepo:  userRepo,
+		mediaRepo: mediaRepo,
+		tokenRepo: tokenRepo,
+	}
+}
+
+// List lista todos os usuários
+func (h *UserHandler) List(c *gin.Context) {
+	users, err := h.userRepo.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuários"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserListResponse{
+		Data:    users,
+		Total:   len(users),
+		Message: "Usuários listados com sucesso",
+	})
+}
+
+// Get retorna um usuário
+func (h *UserHandler) Get(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Create cria um usuário com o papel informado
+func (h *UserHandler) Create(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	user := &models.User{
+		Username: strings.TrimSpace(req.Username),
+		Role:     req.Role,
+	}
+	if user.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome de usuário é obrigatório"})
+		return
+	}
+	if req.Email != nil {
+		email, ok := normalizeEmail(*req.Email)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "E-mail inválido"})
+			return
+		}
+		user.Email = email
+	}
+	if err := user.HashPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criptografar senha"})
+		return
+	}
+
+	if err := h.userRepo.Create(user); err != nil {
+		if respondUserConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar usuário"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// Update altera o nome, o papel e/ou o e-mail de um usuário. Uma mudança de papel
+// encerra as sessões do usuário, para que os tokens emitidos com o papel
+// anterior deixem de valer.
+func (h *UserHandler) Update(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	if req.Username != nil {
+		user.Username = strings.TrimSpace(*req.Username)
+		if user.Username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nome de usuário é obrigatório"})
+			return
+		}
+	}
+
+	if req.Email != nil {
+		email, ok := normalizeEmail(*req.Email)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "E-mail inválido"})
+			return
+		}
+		user.Email = email
+	}
+
+	roleChanged := req.Role != nil && *req.Role != user.Role
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+
+	if err := h.userRepo.Update(user); err != nil {
+		if respondUserConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar usuário"})
+		return
+	}
+
+	if roleChanged {
+		h.revokeSessions(user.ID)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Disable desativa um usuário: ele não consegue mais entrar e suas sessões
+// são encerradas imediatamente. As mídias são mantidas.
+func (h *UserHandler) Disable(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.SetDisabled(user.ID, true); err != nil {
+		if respondUserConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao desativar usuário"})
+		return
+	}
+	h.revokeSessions(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário desativado com sucesso"})
+}
+
+// Enable reativa um usuário desativado
+func (h *UserHandler) Enable(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.SetDisabled(user.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao reativar usuário"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário reativado com sucesso"})
+}
+
+// ResetPassword define uma nova senha para o usuário e encerra suas sessões
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := user.HashPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criptografar senha"})
+		return
+	}
+	if err := h.userRepo.SetPassword(user.ID, user.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar senha"})
+		return
+	}
+	h.revokeSessions(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Senha redefinida com sucesso"})
+}
+
+// Delete exclui um usuário sem mídias. Usuários com mídias (inclusive na
+// lixeira) devem ser desativados, ou ter as mídias excluídas antes, para que
+// os arquivos sejam removidos do armazenamento.
+func (h *UserHandler) Delete(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.mediaRepo.GetUsage(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar mídias do usuário"})
+		return
+	}
+	if usage.Files > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "O usuário possui mídias; exclua-as ou desative o usuário",
+		})
+		return
+	}
+
+	if err := h.userRepo.Delete(user.ID); err != nil {
+		if respondUserConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao excluir usuário"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Usuário excluído com sucesso"})
+}
+
+// loadUser busca o usuário do parâmetro :id, respondendo com erro quando ele
+// não existe
+func (h *UserHandler) loadUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuário"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// normalizeEmail valida um e-mail informado para o usuário e o retorna sem
+// espaços e em minúsculas. Vazio resulta em nil (sem e-mail).
+func normalizeEmail(value string) (*string, bool) {
+	email := strings.ToLower(strings.TrimSpace(value))
+	if email == "" {
+		return nil, true
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return nil, false
+	}
+	return &email, true
+}
+
+// respondUserConflict responde 409 se err indicar nome ou e-mail já em uso,
+// ou uma alteração que deixaria o sistema sem administradores ativos
+func respondUserConflict(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Não é possível remover o último administrador ativo"})
+	case errors.Is(err, repository.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Nome de usuário já está em uso"})
+	case errors.Is(err, repository.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "E-mail já está em uso"})
+	default:
+		return false
+	}
+	return true
+}
+
+// revokeSessions encerra as sessões do usuário. Falhas são apenas registradas
+// em log: a alteração principal já foi gravada.
+func (h *UserHandler) revokeSessions(userID int) {
+	if err := h.tokenRepo.RevokeUserSessions(userID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %d: %v", userID, err)
+	}
+}
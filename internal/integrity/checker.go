@@ -0,0 +1,386 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuarantinePrefix é onde os arquivos órfãos são colocados pelo modo de
+// correção, em vez de serem excluídos
+const QuarantinePrefix = "quarantine"
+
+// ignoredPrefixes são áreas do armazenamento que não pertencem às mídias:
+// uploads tus em andamento e a própria quarentena
+var ignoredPrefixes = []string{".tus/", QuarantinePrefix + "/"}
+
+// ProblemKind identifica o tipo de inconsistência encontrada
+type ProblemKind string
+
+const (
+	// ProblemMissing: o banco referencia um arquivo que não existe
+	ProblemMissing ProblemKind = "missing"
+	// ProblemSizeMismatch: o tamanho do arquivo difere do registrado
+	ProblemSizeMismatch ProblemKind = "size_mismatch"
+	// ProblemChecksumMismatch: o SHA-256 do conteúdo difere do registrado
+	ProblemChecksumMismatch ProblemKind = "checksum_mismatch"
+	// ProblemOrphan: arquivo sem nenhuma referência no banco
+	ProblemOrphan ProblemKind = "orphan"
+	// ProblemRefCount: contador de referências de um blob incorreto
+	ProblemRefCount ProblemKind = "ref_count"
+)
+
+var problemLabels = map[ProblemKind]string{
+	ProblemMissing:          "arquivo ausente",
+	ProblemSizeMismatch:     "tamanho divergente",
+	ProblemChecksumMismatch: "checksum divergente",
+	ProblemOrphan:           "arquivo órfão",
+	ProblemRefCount:         "contador de blob",
+}
+
+var fileKindLabels = map[string]string{
+	"original":  "original",
+	"version":   "versão",
+	"variant":   "variante",
+	"poster":    "poster",
+	"rendition": "playlist HLS",
+}
+
+// Problem é uma inconsistência entre o banco de dados e o armazenamento
+type Problem struct {
+	Kind ProblemKind
+	Key  string
+	// File é a referência do banco envolvida (nula para órfãos e blobs)
+	File *repository.StoredFile
+	// Blob é o registro envolvido em problemas de contador
+	Blob *repository.BlobRecord
+	// Object são os dados do arquivo no armazenamento, quando ele existe
+	Object *storage.ObjectInfo
+	Detail string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s %s", problemLabels[p.Kind], p.Key)
+	if p.File != nil {
+		fmt.Fprintf(&b, " (mídia %d, %s)", p.File.MediaID, fileKindLabels[p.File.Kind])
+	}
+	if p.Detail != "" {
+		b.WriteString(": " + p.Detail)
+	}
+	return b.String()
+}
+
+// Report é o resultado de uma verificação
+type Report struct {
+	// Files é a quantidade de referências a arquivos no banco
+	Files int
+	// Objects é a quantidade de arquivos no armazenamento
+	Objects  int
+	Problems []Problem
+}
+
+// Options ajusta a verificação
+type Options struct {
+	// VerifyChecksums lê o conteúdo dos arquivos com checksum registrado e
+	// confere o SHA-256. Exige ler todo o armazenamento.
+	VerifyChecksums bool
+	// GracePeriod ignora arquivos sem referência mais novos que o período,
+	// que podem pertencer a uploads ou processamentos em andamento
+	GracePeriod time.Duration
+}
+
+// Checker compara os arquivos referenciados no banco de dados com os que
+// existem no armazenamento
+type Checker struct {
+	storage   storage.Backend
+	mediaRepo *repository.MediaRepository
+	blobRepo  *repository.BlobRepository
+}
+
+func NewChecker(store storage.Backend, mediaRepo *repository.MediaRepository, blobRepo *repository.BlobRepository) *Checker {
+	return &Checker{
+		storage:   store,
+		mediaRepo: mediaRepo,
+		blobRepo:  blobRepo,
+	}
+}
+
+// Check percorre o banco e o armazenamento e retorna as inconsistências.
+// Nada é alterado.
+func (c *Checker) Check(ctx context.Context, opts Options) (*Report, error) {
+	files, err := c.mediaRepo.ListStoredFiles()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar arquivos do banco: %w", err)
+	}
+
+	listed, err := c.storage.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar armazenamento: %w", err)
+	}
+
+	objects := make(map[string]*storage.ObjectInfo, len(listed))
+	for i := range listed {
+		if !ignored(listed[i].Key) {
+			objects[listed[i].Key] = &listed[i]
+		}
+	}
+
+	report := &Report{Files: len(files), Objects: len(objects)}
+	referenced := make(map[string]bool, len(files))
+	// Os segmentos HLS não são registrados no banco: qualquer arquivo no
+	// diretório de uma playlist referenciada pertence à rendição
+	renditionDirs := make(map[string]bool)
+	verified := make(map[string]string) // chave -> SHA-256 calculado
+
+	for i := range files {
+		file := &files[i]
+		referenced[file.Key] = true
+		if file.Kind == "rendition" {
+			renditionDirs[path.Dir(file.Key)] = true
+		}
+
+		object, ok := objects[file.Key]
+		if !ok {
+			report.Problems = append(report.Problems, Problem{Kind: ProblemMissing, Key: file.Key, File: file})
+			continue
+		}
+
+		if file.Size != nil && *file.Size != object.Size {
+			report.Problems = append(report.Problems, Problem{
+				Kind:   ProblemSizeMismatch,
+				Key:    file.Key,
+				File:   file,
+				Object: object,
+				Detail: fmt.Sprintf("registrado %d bytes, encontrado %d", *file.Size, object.Size),
+			})
+			continue
+		}
+
+		if opts.VerifyChecksums && file.Checksum != nil && *file.Checksum != "" {
+			sum, seen := verified[file.Key]
+			if !seen {
+				if sum, err = c.checksum(ctx, file.Key); err != nil {
+					return nil, fmt.Errorf("erro ao ler %s: %w", file.Key, err)
+				}
+				verified[file.Key] = sum
+			}
+			if sum != strings.TrimSpace(*file.Checksum) {
+				report.Problems = append(report.Problems, Problem{
+					Kind:   ProblemChecksumMismatch,
+					Key:    file.Key,
+					File:   file,
+					Object: object,
+					Detail: "conteúdo com SHA-256 " + sum,
+				})
+			}
+		}
+	}
+
+	// Arquivos que nenhum registro referencia
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	for key, object := range objects {
+		if referenced[key] || renditionDirs[path.Dir(key)] || object.ModTime.After(cutoff) {
+			continue
+		}
+		report.Problems = append(report.Problems, Problem{
+			Kind:   ProblemOrphan,
+			Key:    key,
+			Object: object,
+			Detail: fmt.Sprintf("%d bytes", object.Size),
+		})
+	}
+
+	blobProblems, err := c.checkBlobs(files)
+	if err != nil {
+		return nil, err
+	}
+	report.Problems = append(report.Problems, blobProblems...)
+
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		if report.Problems[i].Kind != report.Problems[j].Kind {
+			return report.Problems[i].Kind < report.Problems[j].Kind
+		}
+		return report.Problems[i].Key < report.Problems[j].Key
+	})
+
+	return report, nil
+}
+
+// checkBlobs confere os contadores de referência da tabela blobs
+func (c *Checker) checkBlobs(files []repository.StoredFile) ([]Problem, error) {
+	blobs, err := c.blobRepo.List()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar blobs: %w", err)
+	}
+
+	var problems []Problem
+	registered := make(map[string]bool, len(blobs))
+	for i := range blobs {
+		blob := &blobs[i]
+		registered[blob.Checksum] = true
+		if blob.RefCount != blob.References {
+			problems = append(problems, Problem{
+				Kind:   ProblemRefCount,
+				Key:    blob.FilePath,
+				Blob:   blob,
+				Detail: fmt.Sprintf("contador %d, referências %d", blob.RefCount, blob.References),
+			})
+		}
+	}
+
+	// Conteúdos no layout de blobs referenciados sem registro na tabela
+	missing := make(map[string]*repository.BlobRecord)
+	for _, file := range files {
+		if file.Checksum == nil || registered[*file.Checksum] {
+			continue
+		}
+		if _, ok := storage.ParseBlobKey(file.Key); !ok {
+			continue
+		}
+		blob, ok := missing[*file.Checksum]
+		if !ok {
+			blob = &repository.BlobRecord{Checksum: *file.Checksum, FilePath: file.Key}
+			if file.Size != nil {
+				blob.FileSize = *file.Size
+			}
+			missing[*file.Checksum] = blob
+			problems = append(problems, Problem{Kind: ProblemRefCount, Key: file.Key, Blob: blob})
+		}
+		blob.References++
+	}
+	for i := range problems {
+		if problems[i].Detail == "" {
+			problems[i].Detail = fmt.Sprintf("sem registro, referências %d", problems[i].Blob.References)
+		}
+	}
+
+	return problems, nil
+}
+
+// checksum calcula o SHA-256 do conteúdo armazenado na chave
+func (c *Checker) checksum(ctx context.Context, key string) (string, error) {
+	reader, _, err := c.storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	digest := storage.NewDigestReader(reader)
+	if _, err := io.Copy(io.Discard, digest); err != nil {
+		return "", err
+	}
+	return digest.SHA256(), nil
+}
+
+// Quarantine move os arquivos órfãos do relatório para a quarentena,
+// preservando a chave original abaixo de quarantine/<data>/. Blobs sem
+// referências têm o registro removido antes de o arquivo ser movido.
+func (c *Checker) Quarantine(ctx context.Context, report *Report) (int, error) {
+	prefix := path.Join(QuarantinePrefix, time.Now().Format("20060102-150405"))
+	moved := 0
+
+	for _, problem := range report.Problems {
+		if problem.Kind != ProblemOrphan {
+			continue
+		}
+
+		if checksum, ok := storage.ParseBlobKey(problem.Key); ok {
+			references, err := c.blobRepo.Reconcile(checksum, problem.Key, problem.Object.Size)
+			if err != nil {
+				return moved, fmt.Errorf("erro ao ajustar blob %s: %w", checksum, err)
+			}
+			if references > 0 {
+				// Referenciado desde a verificação: não é mais órfão
+				continue
+			}
+		}
+
+		if err := c.storage.Move(ctx, problem.Key, path.Join(prefix, problem.Key)); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return moved, fmt.Errorf("erro ao mover %s para a quarentena: %w", problem.Key, err)
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// MarkBroken registra os problemas do relatório no banco: mídias com o
+// original ausente ou divergente são marcadas como corrompidas (e as que
+// voltaram a estar íntegras são desmarcadas), mídias com variantes ou poster
+// ausentes voltam à fila de processamento e os contadores de blobs são
+// ajustados. Problemas em versões anteriores são apenas reportados.
+func (c *Checker) MarkBroken(ctx context.Context, report *Report) (int, error) {
+	fixed := 0
+	var broken []int
+	reprocess := make(map[int]bool)
+
+	for _, problem := range report.Problems {
+		if err := ctx.Err(); err != nil {
+			return fixed, err
+		}
+
+		switch {
+		case problem.Kind == ProblemRefCount:
+			blob := problem.Blob
+			if _, err := c.blobRepo.Reconcile(blob.Checksum, blob.FilePath, blob.FileSize); err != nil {
+				return fixed, fmt.Errorf("erro ao ajustar blob %s: %w", blob.Checksum, err)
+			}
+			fixed++
+
+		case problem.File == nil:
+			continue
+
+		case problem.File.Kind == "original":
+			reason := problemLabels[problem.Kind]
+			if problem.Detail != "" {
+				reason += ": " + problem.Detail
+			}
+			if err := c.mediaRepo.MarkBroken(problem.File.MediaID, reason); err != nil {
+				return fixed, fmt.Errorf("erro ao marcar mídia %d: %w", problem.File.MediaID, err)
+			}
+			broken = append(broken, problem.File.MediaID)
+			fixed++
+
+		case problem.File.Kind == "variant" || problem.File.Kind == "poster" || problem.File.Kind == "rendition":
+			if reprocess[problem.File.MediaID] {
+				continue
+			}
+			if err := c.mediaRepo.MarkUnprocessed(problem.File.MediaID); err != nil {
+				return fixed, fmt.Errorf("erro ao reprocessar mídia %d: %w", problem.File.MediaID, err)
+			}
+			reprocess[problem.File.MediaID] = true
+			fixed++
+		}
+	}
+
+	cleared, err := c.mediaRepo.ClearBroken(broken)
+	if err != nil {
+		return fixed, fmt.Errorf("erro ao desmarcar mídias íntegras: %w", err)
+	}
+	if cleared > 0 {
+		log.Printf("%d mídia(s) voltaram a estar íntegras", cleared)
+	}
+
+	return fixed, nil
+}
+
+func ignored(key string) bool {
+	for _, prefix := range ignoredPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
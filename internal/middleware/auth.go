@@ -1,15 +1,19 @@
 package middleware
 
 import (
+	"log"
 	"multi-upload-api/internal/auth"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware middleware para autenticação JWT
-func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+// AuthMiddleware middleware para autenticação JWT. Tokens revogados (logout
+// ou sessão encerrada por reuso de refresh token) são recusados.
+func AuthMiddleware(jwtService *auth.JWTService, tokenRepo *repository.TokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -40,13 +44,100 @@ func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := tokenRepo.IsRevoked(claims.ID)
+		if err != nil {
+			log.Printf("Erro ao verificar revogação do token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Erro ao validar token",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Token revogado",
+			})
+			c.Abort()
+			return
+		}
+
 		// Adicionar informações do usuário ao contexto
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth identifica o usuário quando um token válido é enviado, mas não
+// bloqueia requisições anônimas. Usado em rotas públicas que entregam mais
+// conteúdo para o dono autenticado.
+func OptionalAuth(jwtService *auth.JWTService, tokenRepo *repository.TokenRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
+			if claims, err := jwtService.ValidateToken(bearerToken[1]); err == nil {
+				if revoked, err := tokenRepo.IsRevoked(claims.ID); err == nil && !revoked {
+					setClaims(c, claims)
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// setClaims adiciona ao contexto o usuário e a sessão do token
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("session_id", claims.SessionID)
+	c.Set("token_id", claims.ID)
+	c.Set("mfa_setup_required", claims.MFASetupRequired)
+	if claims.ExpiresAt != nil {
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+	}
+}
+
+// RequireRole permite a rota apenas a usuários com o papel informado ou
+// superior. Deve ser usado depois de AuthMiddleware.
+func RequireRole(role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if current, _ := c.Get("role"); current == nil || !current.(models.Role).Allows(role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Permissão insuficiente",
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
+// RequireMFASetup bloqueia a rota para usuários que ainda precisam configurar
+// a autenticação em dois fatores exigida para o seu papel. Deve ser usado
+// depois de AuthMiddleware.
+func RequireMFASetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("mfa_setup_required") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Configure a autenticação em dois fatores para continuar",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetRole obtém o papel do usuário do contexto
+func GetRole(c *gin.Context) (models.Role, bool) {
+	role, exists := c.Get("role")
+	if !exists {
+		return "", false
+	}
+	value, ok := role.(models.Role)
+	return value, ok
+}
+
 // GetUserID obtém o ID do usuário do contexto
 func GetUserID(c *gin.Context) (int, bool) {
 	userID, exists := c.Get("user_id")
@@ -12,10 +12,19 @@ import (
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		// Além dos headers da API: requisições condicionais e parciais dos
+		// arquivos (cache e Range) e os headers do protocolo tus
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+
+			"Range, If-Range, If-None-Match, If-Modified-Since, "+
+			"Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+		c.Header("Access-Control-Expose-Headers", "ETag, Last-Modified, Content-Length, Content-Range, Accept-Ranges, "+
+			"Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, "+
+			"X-Media-Id, X-Duplicate-Of")
 
-		if c.Request.Method == "OPTIONS" {
+		// Apenas requisições de preflight são respondidas aqui; demais OPTIONS
+		// seguem para as rotas (ex.: descoberta do protocolo tus)
+		if c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
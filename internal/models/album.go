@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Album agrupa mídias de um usuário com uma ordem própria. Uma mesma mídia
+// pode fazer parte de vários álbuns.
+type Album struct {
+	ID           int       `json:"id" db:"id"`
+	UserID       int       `json:"user_id" db:"user_id"`
+	Title        string    `json:"title" db:"title"`
+	Slug         string    `json:"slug" db:"slug"`
+	Description  string    `json:"description" db:"description"`
+	CoverMediaID *int      `json:"cover_media_id" db:"cover_media_id"`
+	MediaCount   int       `json:"media_count" db:"media_count"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+
+	Cover *Media `json:"cover"`
+}
+
+type AlbumCreateRequest struct {
+	Title        string `json:"title" binding:"required,max=255"`
+	Slug         string `json:"slug,omitempty" binding:"omitempty,max=255"`
+	Description  string `json:"description,omitempty"`
+	CoverMediaID *int   `json:"cover_media_id,omitempty"`
+}
+
+type AlbumUpdateRequest struct {
+	Title       *string `json:"title,omitempty" binding:"omitempty,min=1,max=255"`
+	Slug        *string `json:"slug,omitempty" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description,omitempty"`
+	// CoverMediaID define a capa; 0 remove a capa atual
+	CoverMediaID *int `json:"cover_media_id,omitempty"`
+}
+
+type AlbumMediaRequest struct {
+	MediaIDs []int `json:"media_ids" binding:"required"`
+}
+
+type AlbumListResponse struct {
+	Data    []Album `json:"data"`
+	Total   int     `json:"total"`
+	Message string  `json:"message,omitempty"`
+}
+
+type AlbumResponse struct {
+	Album      Album   `json:"album"`
+	Media      []Media `json:"media"`
+	Total      int     `json:"total"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	TotalPages int     `json:"total_pages"`
+	Message    string  `json:"message,omitempty"`
+}
@@ -11,18 +11,117 @@ const (
 	MediaTypeVideo MediaType = "video"
 )
 
+// Visibility controla quem pode ver uma mídia
+type Visibility string
+
+const (
+	// VisibilityPrivate: apenas o dono
+	VisibilityPrivate Visibility = "private"
+	// VisibilityUnlisted: acessível por quem tem o link, mas fora da galeria
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPublic: listada na galeria pública
+	VisibilityPublic Visibility = "public"
+)
+
+// Valid indica se o valor é uma visibilidade conhecida
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
 type Media struct {
+	ID           int        `json:"id" db:"id"`
+	UserID       int        `json:"user_id" db:"user_id"`
+	Filename     string     `json:"filename" db:"filename"`
+	OriginalName string     `json:"original_name" db:"original_name"`
+	FilePath     string     `json:"file_path" db:"file_path"`
+	FileSize     int64      `json:"file_size" db:"file_size"`
+	Checksum     *string    `json:"checksum" db:"checksum"`
+	MimeType     string     `json:"mime_type" db:"mime_type"`
+	MediaType    MediaType  `json:"media_type" db:"media_type"`
+	SortOrder    int        `json:"sort_order" db:"sort_order"`
+	Visibility   Visibility `json:"visibility" db:"visibility"`
+	Title        string     `json:"title" db:"title"`
+	Description  string     `json:"description" db:"description"`
+	AltText      string     `json:"alt_text" db:"alt_text"`
+	Duration     *float64   `json:"duration,omitempty" db:"duration"`
+	Width        *int       `json:"width,omitempty" db:"width"`
+	Height       *int       `json:"height,omitempty" db:"height"`
+	VideoCodec   *string    `json:"video_codec,omitempty" db:"video_codec"`
+	PosterPath   *string    `json:"poster_path,omitempty" db:"poster_path"`
+	ProcessedAt  *time.Time `json:"processed_at" db:"processed_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	BrokenAt     *time.Time `json:"broken_at,omitempty" db:"broken_at"`
+	BrokenReason *string    `json:"broken_reason,omitempty" db:"broken_reason"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+
+	Tags       []string         `json:"tags"`
+	Variants   []MediaVariant   `json:"variants"`
+	Renditions []MediaRendition `json:"renditions"`
+}
+
+// MediaVariant é uma versão redimensionada de uma imagem, usada para montar
+// listas srcset no frontend
+type MediaVariant struct {
+	ID        int       `json:"id" db:"id"`
+	MediaID   int       `json:"media_id" db:"media_id"`
+	Name      string    `json:"name" db:"name"`
+	Width     int       `json:"width" db:"width"`
+	Height    int       `json:"height" db:"height"`
+	Format    string    `json:"format" db:"format"`
+	MimeType  string    `json:"mime_type" db:"mime_type"`
+	FilePath  string    `json:"file_path" db:"file_path"`
+	FileSize  int64     `json:"file_size" db:"file_size"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// HLSPlaylistName é o nome da playlist de cada rendição HLS. Os segmentos
+// ficam no mesmo diretório da playlist.
+const HLSPlaylistName = "index.m3u8"
+
+// MediaRendition é uma versão de um vídeo empacotada em HLS, referenciada
+// pela playlist master de /media/:id/stream.m3u8
+type MediaRendition struct {
+	ID      int    `json:"id" db:"id"`
+	MediaID int    `json:"media_id" db:"media_id"`
+	Name    string `json:"name" db:"name"`
+	Width   int    `json:"width" db:"width"`
+	Height  int    `json:"height" db:"height"`
+	// Bandwidth é a taxa de pico em bits por segundo, usada no BANDWIDTH da playlist master
+	Bandwidth    int    `json:"bandwidth" db:"bandwidth"`
+	PlaylistPath string `json:"playlist_path" db:"playlist_path"`
+	// FileSize é a soma dos tamanhos da playlist e dos segmentos
+	FileSize  int64     `json:"file_size" db:"file_size"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// MediaVersion é um arquivo anterior de uma mídia, guardado quando o arquivo
+// é substituído
+type MediaVersion struct {
 	ID           int       `json:"id" db:"id"`
-	UserID       int       `json:"user_id" db:"user_id"`
+	MediaID      int       `json:"media_id" db:"media_id"`
 	Filename     string    `json:"filename" db:"filename"`
 	OriginalName string    `json:"original_name" db:"original_name"`
 	FilePath     string    `json:"file_path" db:"file_path"`
 	FileSize     int64     `json:"file_size" db:"file_size"`
+	Checksum     *string   `json:"checksum" db:"checksum"`
 	MimeType     string    `json:"mime_type" db:"mime_type"`
 	MediaType    MediaType `json:"media_type" db:"media_type"`
-	SortOrder    int       `json:"sort_order" db:"sort_order"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ReplacedBy   *int      `json:"replaced_by" db:"replaced_by"`
+	ReplacedAt   time.Time `json:"replaced_at" db:"replaced_at"`
+}
+
+// VideoInfo reúne os dados extraídos de um vídeo pelo processamento
+type VideoInfo struct {
+	Duration   float64
+	Width      int
+	Height     int
+	VideoCodec string
+	PosterPath string
 }
 
 type MediaListResponse struct {
@@ -34,15 +133,85 @@ type MediaListResponse struct {
 	Message    string  `json:"message"`
 }
 
+type MediaVersionListResponse struct {
+	Data    []MediaVersion `json:"data"`
+	Total   int            `json:"total"`
+	Message string         `json:"message"`
+}
+
 type UploadResponse struct {
 	Media   Media  `json:"media"`
 	Message string `json:"message"`
 }
 
+// UploadError descreve o motivo da rejeição de um arquivo em um upload múltiplo
+type UploadError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// UploadResult representa o resultado individual de um arquivo enviado
+type UploadResult struct {
+	OriginalName string       `json:"original_name"`
+	Media        *Media       `json:"media,omitempty"`
+	Error        *UploadError `json:"error,omitempty"`
+	// DuplicateOf indica uma mídia do usuário que já tem o mesmo conteúdo
+	DuplicateOf *int `json:"duplicate_of,omitempty"`
+}
+
+type MultiUploadResponse struct {
+	Results  []UploadResult `json:"results"`
+	Uploaded int            `json:"uploaded"`
+	Failed   int            `json:"failed"`
+	// Error é a falha do envio como um todo (ex.: formulário interrompido),
+	// além das falhas de cada arquivo em Results
+	Error   *UploadError `json:"error,omitempty"`
+	Message string       `json:"message"`
+}
+
 type MediaUpdateRequest struct {
-	SortOrder *int `json:"sort_order,omitempty"`
+	SortOrder   *int        `json:"sort_order,omitempty"`
+	Visibility  *Visibility `json:"visibility,omitempty" binding:"omitempty,oneof=private unlisted public"`
+	Title       *string     `json:"title,omitempty" binding:"omitempty,max=255"`
+	Description *string     `json:"description,omitempty"`
+	AltText     *string     `json:"alt_text,omitempty" binding:"omitempty,max=500"`
+	// Tags substitui o conjunto de tags da mídia; uma lista vazia remove todas
+	Tags *[]string `json:"tags,omitempty" binding:"omitempty,max=50,dive,max=100"`
 }
 
 type SortOrderRequest struct {
 	MediaIDs []int `json:"media_ids" binding:"required"`
 }
+
+// TypePolicy descreve o que é aceito para um tipo de mídia
+type TypePolicy struct {
+	// MaxSize é o tamanho máximo em bytes; nulo quando não há limite
+	MaxSize      *int64   `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types"`
+}
+
+// UploadPolicy permite que os clientes validem os arquivos antes do envio
+type UploadPolicy struct {
+	Image             TypePolicy `json:"image"`
+	Video             TypePolicy `json:"video"`
+	DefaultVisibility Visibility `json:"default_visibility"`
+	RejectDuplicates  bool       `json:"reject_duplicates"`
+}
+
+// MediaLinkRequest pede uma URL assinada para um arquivo da mídia
+type MediaLinkRequest struct {
+	// ExpiresIn é a validade em segundos (0 usa o padrão)
+	ExpiresIn int `json:"expires_in" binding:"min=0"`
+	// BindIP restringe a URL ao endereço IP de quem fez o pedido
+	BindIP bool `json:"bind_ip"`
+	// Variant escolhe o arquivo: vazio para o original, "poster" ou o nome
+	// de uma variante
+	Variant string `json:"variant"`
+}
+
+type MediaLinkResponse struct {
+	URL       string    `json:"url"`
+	FilePath  string    `json:"file_path"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Message   string    `json:"message"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// MFAChallengeResponse é a resposta do login quando o usuário tem a
+// autenticação em dois fatores ativa: o token do desafio deve ser enviado
+// com o código em /login/mfa
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"mfa_expires_at"`
+}
+
+// MFAVerifyRequest conclui o login com um código TOTP ou de recuperação
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFASetupResponse traz o segredo TOTP e a URI para o QR code do autenticador
+type MFASetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest confirma uma operação com um código TOTP (ou de recuperação)
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFADisableRequest desativa a autenticação em dois fatores do próprio usuário
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse traz os códigos de recuperação, mostrados uma única vez
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Message       string   `json:"message"`
+}
+
+// MFAPolicy lista os papéis para os quais a autenticação em dois fatores é
+// obrigatória
+type MFAPolicy struct {
+	RequiredRoles []Role `json:"required_roles" binding:"required,dive,oneof=admin editor viewer"`
+}
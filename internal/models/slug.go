@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify gera um identificador amigável para URLs, sem acentos e em minúsculas
+// ("Guindaste Móvel 50t" -> "guindaste-movel-50t")
+func Slugify(value string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range norm.NFD.String(strings.ToLower(strings.TrimSpace(value))) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Remover acentos (marcas de combinação após a decomposição)
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			dash = false
+		default:
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// RefreshToken é um refresh token emitido para uma sessão. Apenas o hash
+// SHA-256 do token é armazenado. Cada uso gera um novo token na mesma família
+// (rotação); a família identifica a sessão aberta no login.
+type RefreshToken struct {
+	ID        int    `db:"id"`
+	UserID    int    `db:"user_id"`
+	FamilyID  string `db:"family_id"`
+	TokenHash string `db:"token_hash"`
+	// AccessTokenID é o jti do access token emitido junto com este refresh
+	// token, revogado se a família for encerrada
+	AccessTokenID   string     `db:"access_token_id"`
+	AccessExpiresAt time.Time  `db:"access_expires_at"`
+	ExpiresAt       time.Time  `db:"expires_at"`
+	UsedAt          *time.Time `db:"used_at"`
+	RevokedAt       *time.Time `db:"revoked_at"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+// ForgotPasswordRequest pede o envio de um token de redefinição de senha
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// PasswordResetRequest redefine a senha com o token recebido por e-mail
+type PasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6,max=72"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse é o par de tokens retornado no login e na renovação
+type TokenResponse struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	// MFASetupRequired indica que o papel do usuário exige autenticação em
+	// dois fatores e que ele ainda precisa configurá-la: até lá, o token só
+	// dá acesso a /me, /logout e /me/mfa
+	MFASetupRequired bool `json:"mfa_setup_required,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Upload representa um upload resumível (protocolo tus) em andamento
+type Upload struct {
+	ID          string    `json:"id" db:"id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	Length      int64     `json:"length" db:"upload_length"`
+	Offset      int64     `json:"offset" db:"upload_offset"`
+	Metadata    string    `json:"metadata" db:"metadata"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	MediaID     *int      `json:"media_id,omitempty" db:"media_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ExpiresAt retorna quando o upload expira, após ttl sem receber dados
+func (u *Upload) ExpiresAt(ttl time.Duration) time.Time {
+	return u.UpdatedAt.Add(ttl)
+}
+
+// Completed indica se todos os bytes do upload já foram recebidos
+func (u *Upload) Completed() bool {
+	return u.Offset >= u.Length
+}
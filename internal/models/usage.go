@@ -0,0 +1,45 @@
+package models
+
+// UsageTotals soma a quantidade e o tamanho de um grupo de arquivos
+type UsageTotals struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Usage é o espaço ocupado por um usuário. Mídias na lixeira e versões
+// anteriores contam até serem excluídas definitivamente; versões somam apenas
+// bytes, não arquivos. O tamanho considerado é o de cada mídia, mesmo quando
+// o conteúdo é compartilhado com outras.
+type Usage struct {
+	UsageTotals
+	ByMediaType map[MediaType]UsageTotals `json:"by_media_type"`
+	Trash       UsageTotals               `json:"trash"`
+	Versions    UsageTotals               `json:"versions"`
+}
+
+// Quota é o limite efetivo de um usuário. Zero significa sem limite.
+type Quota struct {
+	Bytes int64
+	Files int
+}
+
+// Remaining retorna quanto ainda pode ser usado; -1 indica sem limite
+func (q Quota) Remaining(usage *Usage) (bytes int64, files int) {
+	bytes, files = -1, -1
+	if q.Bytes > 0 {
+		bytes = max(q.Bytes-usage.Bytes, 0)
+	}
+	if q.Files > 0 {
+		files = max(q.Files-usage.Files, 0)
+	}
+	return bytes, files
+}
+
+type UsageResponse struct {
+	Usage
+	// Limites e saldo; nulos quando não há limite
+	QuotaBytes     *int64 `json:"quota_bytes"`
+	QuotaFiles     *int   `json:"quota_files"`
+	RemainingBytes *int64 `json:"remaining_bytes"`
+	RemainingFiles *int   `json:"remaining_files"`
+}
@@ -6,12 +6,50 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Role define o que um usuário pode fazer. Cada papel inclui as permissões
+// dos anteriores: viewer < editor < admin.
+type Role string
+
+const (
+	// RoleViewer: apenas consulta as mídias e álbuns
+	RoleViewer Role = "viewer"
+	// RoleEditor: também envia, edita, reordena e exclui mídias e álbuns
+	RoleEditor Role = "editor"
+	// RoleAdmin: também gerencia as contas de usuário
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// Valid indica se o valor é um papel conhecido
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Allows indica se o papel tem as permissões de required
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleLevels[r] >= roleLevels[required]
+}
+
 type User struct {
-	ID        int       `json:"id" db:"id"`
-	Username  string    `json:"username" db:"username"`
-	Password  string    `json:"-" db:"password"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID       int    `json:"id" db:"id"`
+	Username string `json:"username" db:"username"`
+	Password string `json:"-" db:"password"`
+	Role     Role   `json:"role" db:"role"`
+	// Email é usado apenas na recuperação de senha
+	Email *string `json:"email" db:"email"`
+	// TOTPSecret é o segredo da autenticação em dois fatores, gravado na
+	// configuração e exigido no login apenas depois de MFAEnabledAt
+	TOTPSecret   *string    `json:"-" db:"totp_secret"`
+	MFAEnabledAt *time.Time `json:"mfa_enabled_at" db:"mfa_enabled_at"`
+	// DisabledAt indica que o usuário foi desativado e não pode mais entrar
+	DisabledAt *time.Time `json:"disabled_at" db:"disabled_at"`
+	// Cota do usuário; nula usa o padrão da configuração e 0 é sem limite
+	QuotaBytes *int64    `json:"quota_bytes" db:"quota_bytes"`
+	QuotaFiles *int      `json:"quota_files" db:"quota_files"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type LoginRequest struct {
@@ -20,8 +58,32 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	TokenResponse
+	User User `json:"user"`
+}
+
+type CreateUserRequest struct {
+	Username string  `json:"username" binding:"required,max=255"`
+	Password string  `json:"password" binding:"required,min=6,max=72"`
+	Role     Role    `json:"role" binding:"required,oneof=admin editor viewer"`
+	Email    *string `json:"email,omitempty" binding:"omitempty,max=255"`
+}
+
+type UpdateUserRequest struct {
+	Username *string `json:"username,omitempty" binding:"omitempty,min=1,max=255"`
+	Role     *Role   `json:"role,omitempty" binding:"omitempty,oneof=admin editor viewer"`
+	// Email vazio remove o e-mail do usuário
+	Email *string `json:"email,omitempty" binding:"omitempty,max=255"`
+}
+
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"required,min=6,max=72"`
+}
+
+type UserListResponse struct {
+	Data    []User `json:"data"`
+	Total   int    `json:"total"`
+	Message string `json:"message"`
 }
 
 // HashPassword criptografa a senha usando bcrypt
@@ -0,0 +1,33 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Executor executa programas externos (ffprobe, ffmpeg). É uma interface para
+// que o pipeline possa ser exercitado com uma implementação falsa, sem os
+// binários instalados.
+type Executor interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// CommandExecutor executa os programas no sistema operacional
+type CommandExecutor struct{}
+
+func (CommandExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,288 @@
+package processing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// hlsContentTypes são os tipos dos arquivos gerados pelo empacotamento HLS
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// HLSStep empacota os vídeos em HLS, com uma rendição H.264/AAC por altura
+// configurada, para reprodução adaptativa. Depende da resolução registrada
+// por VideoProbeStep, que deve ser executada antes.
+type HLSStep struct {
+	storage        storage.Backend
+	mediaRepo      *repository.MediaRepository
+	exec           Executor
+	ffmpeg         string
+	heights        []int
+	segmentSeconds int
+}
+
+func NewHLSStep(store storage.Backend, mediaRepo *repository.MediaRepository, exec Executor, ffmpeg string, heights []int, segmentSeconds int) *HLSStep {
+	heights = append([]int(nil), heights...)
+	sort.Ints(heights)
+	if segmentSeconds < 1 {
+		segmentSeconds = 6
+	}
+
+	return &HLSStep{
+		storage:        store,
+		mediaRepo:      mediaRepo,
+		exec:           exec,
+		ffmpeg:         ffmpeg,
+		heights:        heights,
+		segmentSeconds: segmentSeconds,
+	}
+}
+
+func (s *HLSStep) Name() string {
+	return "hls"
+}
+
+func (s *HLSStep) Applies(media *models.Media) bool {
+	return media.MediaType == models.MediaTypeVideo && len(s.heights) > 0
+}
+
+func (s *HLSStep) Process(ctx context.Context, media *models.Media) error {
+	if media.Width == nil || media.Height == nil || *media.Width <= 0 || *media.Height <= 0 {
+		return errors.New("resolução do vídeo desconhecida")
+	}
+
+	input, cleanup, err := localCopy(ctx, s.storage, media.FilePath)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	tmpDir, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Cada empacotamento usa um diretório novo: as chaves nunca são
+	// reaproveitadas para outro conteúdo
+	prefix := path.Join("hls", strconv.Itoa(media.ID), uuid.New().String()) + "/"
+
+	var renditions []models.MediaRendition
+	for _, height := range s.renditionHeights(*media.Height) {
+		width := evenRound(float64(*media.Width) * float64(height) / float64(*media.Height))
+
+		rendition, err := s.render(ctx, input, tmpDir, prefix, width, height)
+		if err != nil {
+			storage.DeletePrefix(ctx, s.storage, prefix)
+			return err
+		}
+		renditions = append(renditions, *rendition)
+	}
+
+	previous, err := s.mediaRepo.ReplaceRenditions(media.ID, renditions)
+	if err != nil {
+		storage.DeletePrefix(ctx, s.storage, prefix)
+		return fmt.Errorf("erro ao salvar rendições: %w", err)
+	}
+	media.Renditions = renditions
+
+	// Remover os arquivos do empacotamento anterior
+	for _, rendition := range previous {
+		storage.DeletePrefix(ctx, s.storage, path.Dir(rendition.PlaylistPath)+"/")
+	}
+
+	return nil
+}
+
+// renditionHeights retorna as alturas a gerar para um vídeo de altura
+// source. Nunca amplia: alturas maiores que o original são ignoradas e, se
+// nenhuma couber, é gerada uma única rendição na altura original.
+func (s *HLSStep) renditionHeights(source int) []int {
+	var heights []int
+	for _, height := range s.heights {
+		if height > source {
+			break
+		}
+		heights = append(heights, height)
+	}
+	if len(heights) == 0 {
+		heights = []int{evenRound(float64(source))}
+	}
+	return heights
+}
+
+// render gera uma rendição com o ffmpeg e grava a playlist e os segmentos no
+// armazenamento, abaixo de prefix
+func (s *HLSStep) render(ctx context.Context, input, tmpDir, prefix string, width, height int) (*models.MediaRendition, error) {
+	name := strconv.Itoa(height) + "p"
+	dir := filepath.Join(tmpDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Teto de ~0,1 bit por pixel a 30 quadros por segundo
+	maxRate := width * height * 3
+	segment := strconv.Itoa(s.segmentSeconds)
+
+	_, err := s.exec.Run(ctx, s.ffmpeg,
+		"-v", "error",
+		"-y",
+		"-i", input,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-maxrate", strconv.Itoa(maxRate),
+		"-bufsize", strconv.Itoa(2*maxRate),
+		"-pix_fmt", "yuv420p",
+		// Quadros-chave alinhados aos segmentos, para que o player possa
+		// trocar de rendição em qualquer fronteira
+		"-force_key_frames", "expr:gte(t,n_forced*"+segment+")",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-ac", "2",
+		"-f", "hls",
+		"-hls_time", segment,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%04d.ts"),
+		filepath.Join(dir, models.HLSPlaylistName),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	bandwidth, err := peakBandwidth(dir)
+	if err != nil {
+		return nil, err
+	}
+	if bandwidth == 0 {
+		bandwidth = maxRate
+	}
+
+	size, err := s.upload(ctx, dir, prefix+name+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MediaRendition{
+		Name:         name,
+		Width:        width,
+		Height:       height,
+		Bandwidth:    bandwidth,
+		PlaylistPath: prefix + name + "/" + models.HLSPlaylistName,
+		FileSize:     size,
+	}, nil
+}
+
+// upload grava os arquivos de dir no armazenamento abaixo de prefix. A
+// playlist é gravada por último, depois de todos os segmentos que referencia.
+func (s *HLSStep) upload(ctx context.Context, dir, prefix string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[j].Name() == models.HLSPlaylistName && entries[i].Name() != models.HLSPlaylistName
+	})
+
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		size, err := s.put(ctx, filepath.Join(dir, entry.Name()), prefix+entry.Name())
+		if err != nil {
+			return 0, fmt.Errorf("erro ao gravar %s: %w", entry.Name(), err)
+		}
+		total += size
+	}
+
+	return total, nil
+}
+
+func (s *HLSStep) put(ctx context.Context, file, key string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := hlsContentTypes[path.Ext(key)]
+	if err := s.storage.Put(ctx, key, f, stat.Size(), contentType); err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// peakBandwidth calcula a maior taxa, em bits por segundo, entre os
+// segmentos listados na playlist de dir (EXTINF seguido do arquivo)
+func peakBandwidth(dir string) (int, error) {
+	playlist, err := os.Open(filepath.Join(dir, models.HLSPlaylistName))
+	if err != nil {
+		return 0, fmt.Errorf("playlist não gerada: %w", err)
+	}
+	defer playlist.Close()
+
+	peak := 0.0
+	duration := 0.0
+	scanner := bufio.NewScanner(playlist)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			duration, _ = strconv.ParseFloat(value, 64)
+
+		case line != "" && !strings.HasPrefix(line, "#"):
+			stat, err := os.Stat(filepath.Join(dir, filepath.Base(line)))
+			if err != nil {
+				return 0, fmt.Errorf("segmento %s não gerado: %w", line, err)
+			}
+			if duration > 0 {
+				if rate := float64(stat.Size()*8) / duration; rate > peak {
+					peak = rate
+				}
+			}
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return int(peak + 0.5), nil
+}
+
+// evenRound arredonda para o par mais próximo, exigido pelo H.264 com yuv420p
+func evenRound(value float64) int {
+	even := 2 * int(value/2+0.5)
+	if even < 2 {
+		even = 2
+	}
+	return even
+}
@@ -0,0 +1,191 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// variantFormats são os formatos de saída suportados para as variantes
+var variantFormats = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+}
+
+// ImageVariantStep gera versões redimensionadas das imagens enviadas
+type ImageVariantStep struct {
+	storage   storage.Backend
+	mediaRepo *repository.MediaRepository
+	widths    []int
+	formats   []string
+	quality   int
+}
+
+func NewImageVariantStep(store storage.Backend, mediaRepo *repository.MediaRepository, widths []int, formats []string, quality int) *ImageVariantStep {
+	widths = append([]int(nil), widths...)
+	sort.Ints(widths)
+
+	var supported []string
+	for _, format := range formats {
+		format = strings.ToLower(format)
+		if format == "jpg" {
+			format = "jpeg"
+		}
+		if _, ok := variantFormats[format]; !ok {
+			log.Printf("[Processing] formato de variante não suportado ignorado: %s", format)
+			continue
+		}
+		supported = append(supported, format)
+	}
+
+	return &ImageVariantStep{
+		storage:   store,
+		mediaRepo: mediaRepo,
+		widths:    widths,
+		formats:   supported,
+		quality:   quality,
+	}
+}
+
+func (s *ImageVariantStep) Name() string {
+	return "image_variants"
+}
+
+func (s *ImageVariantStep) Applies(media *models.Media) bool {
+	return media.MediaType == models.MediaTypeImage && len(s.widths) > 0 && len(s.formats) > 0
+}
+
+func (s *ImageVariantStep) Process(ctx context.Context, media *models.Media) error {
+	reader, _, err := s.storage.Get(ctx, media.FilePath)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir original: %w", err)
+	}
+	src, _, err := image.Decode(reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("erro ao decodificar imagem: %w", err)
+	}
+
+	bounds := src.Bounds()
+	var variants []models.MediaVariant
+	generation := uuid.New().String()
+
+	for _, width := range s.widths {
+		// Nunca ampliar: larguras maiores que o original são ignoradas
+		if width >= bounds.Dx() {
+			break
+		}
+		height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+
+		for _, format := range s.formats {
+			variant, err := s.render(ctx, media, generation, src, width, height, format)
+			if err != nil {
+				for _, rendered := range variants {
+					s.storage.Delete(ctx, rendered.FilePath)
+				}
+				return err
+			}
+			variants = append(variants, *variant)
+		}
+	}
+
+	previous, err := s.mediaRepo.ReplaceVariants(media.ID, variants)
+	if err != nil {
+		for _, variant := range variants {
+			s.storage.Delete(ctx, variant.FilePath)
+		}
+		return fmt.Errorf("erro ao salvar variantes: %w", err)
+	}
+	media.Variants = variants
+
+	// Remover arquivos de variantes antigas que não foram sobrescritos
+	current := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		current[variant.FilePath] = true
+	}
+	for _, variant := range previous {
+		if !current[variant.FilePath] {
+			s.storage.Delete(ctx, variant.FilePath)
+		}
+	}
+
+	return nil
+}
+
+// render redimensiona a imagem, codifica no formato pedido e grava no armazenamento
+func (s *ImageVariantStep) render(ctx context.Context, media *models.Media, generation string, src image.Image, width, height int, format string) (*models.MediaVariant, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if format == "jpeg" {
+		// JPEG não tem transparência: usar fundo branco
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: s.quality}); err != nil {
+			return nil, err
+		}
+	case "png":
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, err
+		}
+	}
+
+	name := strconv.Itoa(width) + "w"
+	if len(s.formats) > 1 {
+		name += "-" + format
+	}
+
+	mimeType := variantFormats[format]
+	key := variantKey(media, generation, width, format)
+	size := int64(buf.Len())
+
+	if err := s.storage.Put(ctx, key, &buf, size, mimeType); err != nil {
+		return nil, fmt.Errorf("erro ao gravar variante %s: %w", name, err)
+	}
+
+	return &models.MediaVariant{
+		MediaID:  media.ID,
+		Name:     name,
+		Width:    width,
+		Height:   height,
+		Format:   format,
+		MimeType: mimeType,
+		FilePath: key,
+		FileSize: size,
+	}, nil
+}
+
+// VariantKey monta a chave de uma variante. Cada processamento grava as
+// variantes em um diretório próprio (generation), para que uma chave nunca
+// volte a ser usada com outro conteúdo, mesmo quando uma versão antiga, com o
+// mesmo nome de arquivo, é restaurada.
+func variantKey(media *models.Media, generation string, width int, format string) string {
+	stem := strings.TrimSuffix(media.Filename, path.Ext(media.Filename))
+	ext := format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	return path.Join("variants", strconv.Itoa(media.ID), generation, fmt.Sprintf("%s_%dw.%s", stem, width, ext))
+}
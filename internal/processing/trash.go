@@ -0,0 +1,110 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"path"
+	"time"
+)
+
+const (
+	// purgeInterval define de quanto em quanto tempo a lixeira é verificada
+	purgeInterval = time.Hour
+	// purgeBatchSize limita quantas mídias são buscadas por consulta
+	purgeBatchSize = 100
+)
+
+// TrashPurger exclui definitivamente as mídias que estão na lixeira há mais
+// tempo que a retenção configurada, junto com seus arquivos
+type TrashPurger struct {
+	storage   storage.Backend
+	mediaRepo *repository.MediaRepository
+	retention time.Duration
+}
+
+func NewTrashPurger(store storage.Backend, mediaRepo *repository.MediaRepository, retention time.Duration) *TrashPurger {
+	return &TrashPurger{
+		storage:   store,
+		mediaRepo: mediaRepo,
+		retention: retention,
+	}
+}
+
+// Start verifica a lixeira imediatamente e depois a cada purgeInterval, até
+// que ctx seja cancelado
+func (p *TrashPurger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if purged, err := p.Purge(ctx); err != nil {
+				log.Printf("[Trash] erro ao esvaziar lixeira: %v", err)
+			} else if purged > 0 {
+				log.Printf("[Trash] %d mídia(s) excluída(s) definitivamente", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Purge exclui as mídias vencidas e retorna quantas foram excluídas. O
+// registro é removido antes dos arquivos; uma falha ao remover um arquivo é
+// apenas registrada em log (o arquivo órfão é apontado pelo fsck).
+func (p *TrashPurger) Purge(ctx context.Context) (int, error) {
+	purged := 0
+	before := time.Now().Add(-p.retention)
+
+	for {
+		medias, err := p.mediaRepo.ListExpiredTrash(before, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, media := range medias {
+			// A exclusão e a liberação das referências aos originais são feitas
+			// juntas, e só acontecem se a mídia ainda estiver vencida na lixeira:
+			// uma mídia restaurada depois de listada, ou já excluída por outra
+			// instância, é ignorada
+			keys, deleted, err := p.mediaRepo.PurgeTrashed(media.ID, before)
+			if err != nil {
+				return purged, err
+			}
+			if !deleted {
+				continue
+			}
+			purged++
+
+			for _, variant := range media.Variants {
+				keys = append(keys, variant.FilePath)
+			}
+			if media.PosterPath != nil {
+				keys = append(keys, *media.PosterPath)
+			}
+
+			for _, key := range keys {
+				if err := p.storage.Delete(ctx, key); err != nil {
+					log.Printf("[Trash] erro ao remover arquivo %s da mídia %d: %v", key, media.ID, err)
+				}
+			}
+
+			for _, rendition := range media.Renditions {
+				dir := path.Dir(rendition.PlaylistPath) + "/"
+				if err := storage.DeletePrefix(ctx, p.storage, dir); err != nil {
+					log.Printf("[Trash] erro ao remover diretório %s da mídia %d: %v", dir, media.ID, err)
+				}
+			}
+		}
+
+		if len(medias) < purgeBatchSize || ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"multi-upload-api/internal/repository"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UploadSweeper descarta os uploads resumíveis (tus) sem atividade há mais
+// que ttl: o registro e o arquivo parcial
+type UploadSweeper struct {
+	uploadRepo *repository.UploadRepository
+	dir        string
+	ttl        time.Duration
+}
+
+func NewUploadSweeper(uploadRepo *repository.UploadRepository, dir string, ttl time.Duration) *UploadSweeper {
+	return &UploadSweeper{
+		uploadRepo: uploadRepo,
+		dir:        dir,
+		ttl:        ttl,
+	}
+}
+
+// Start verifica os uploads imediatamente e depois a cada purgeInterval, até
+// que ctx seja cancelado
+func (s *UploadSweeper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if swept, err := s.Sweep(); err != nil {
+				log.Printf("[Uploads] erro ao descartar uploads expirados: %v", err)
+			} else if swept > 0 {
+				log.Printf("[Uploads] %d upload(s) expirado(s) descartado(s)", swept)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sweep exclui os uploads expirados e retorna quantos foram excluídos. Também
+// remove arquivos parciais antigos sem registro (por exemplo, de usuários
+// excluídos).
+func (s *UploadSweeper) Sweep() (int, error) {
+	before := time.Now().Add(-s.ttl)
+
+	ids, err := s.uploadRepo.DeleteExpired(before)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := os.Remove(filepath.Join(s.dir, id)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Uploads] erro ao remover arquivo parcial %s: %v", id, err)
+		}
+	}
+
+	// Uploads ativos atualizam o arquivo a cada PATCH: um arquivo parado há
+	// mais que ttl pertence a um upload expirado
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return len(ids), nil
+		}
+		return len(ids), err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Uploads] erro ao remover arquivo parcial %s: %v", entry.Name(), err)
+		}
+	}
+
+	return len(ids), nil
+}
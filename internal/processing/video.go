@@ -0,0 +1,219 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// VideoProbeStep extrai duração, resolução e codec dos vídeos com o ffprobe
+// e gera um poster JPEG com o ffmpeg
+type VideoProbeStep struct {
+	storage   storage.Backend
+	mediaRepo *repository.MediaRepository
+	exec      Executor
+	ffprobe   string
+	ffmpeg    string
+}
+
+func NewVideoProbeStep(store storage.Backend, mediaRepo *repository.MediaRepository, exec Executor, ffprobe, ffmpeg string) *VideoProbeStep {
+	return &VideoProbeStep{
+		storage:   store,
+		mediaRepo: mediaRepo,
+		exec:      exec,
+		ffprobe:   ffprobe,
+		ffmpeg:    ffmpeg,
+	}
+}
+
+func (s *VideoProbeStep) Name() string {
+	return "video_probe"
+}
+
+func (s *VideoProbeStep) Applies(media *models.Media) bool {
+	return media.MediaType == models.MediaTypeVideo
+}
+
+func (s *VideoProbeStep) Process(ctx context.Context, media *models.Media) error {
+	input, cleanup, err := localCopy(ctx, s.storage, media.FilePath)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := s.probe(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	previousPoster := media.PosterPath
+	posterPath, err := s.poster(ctx, media, input, info.Duration)
+	if err != nil {
+		return err
+	}
+	info.PosterPath = posterPath
+
+	if err := s.mediaRepo.UpdateVideoInfo(media.ID, info); err != nil {
+		s.storage.Delete(ctx, posterPath)
+		return fmt.Errorf("erro ao salvar dados do vídeo: %w", err)
+	}
+
+	media.Duration = &info.Duration
+	media.Width = &info.Width
+	media.Height = &info.Height
+	media.VideoCodec = &info.VideoCodec
+	media.PosterPath = &info.PosterPath
+
+	// O poster de um processamento anterior não é mais referenciado
+	if previousPoster != nil && *previousPoster != posterPath {
+		s.storage.Delete(ctx, *previousPoster)
+	}
+	return nil
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Duration  string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probe lê os metadados do vídeo a partir da saída JSON do ffprobe
+func (s *VideoProbeStep) probe(ctx context.Context, input string) (*models.VideoInfo, error) {
+	out, err := s.exec.Run(ctx, s.ffprobe,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		input,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("saída inválida do ffprobe: %w", err)
+	}
+
+	info := &models.VideoInfo{}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		info.Width = stream.Width
+		info.Height = stream.Height
+		info.VideoCodec = stream.CodecName
+		if info.Duration == 0 {
+			info.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+		}
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("nenhuma faixa de vídeo encontrada")
+}
+
+// poster extrai um quadro do vídeo como JPEG e grava no armazenamento
+func (s *VideoProbeStep) poster(ctx context.Context, media *models.Media, input string, duration float64) (string, error) {
+	// Evitar o primeiro quadro, que costuma ser preto
+	offset := 1.0
+	if duration > 0 && duration < 2 {
+		offset = duration / 2
+	}
+
+	tmpDir, err := os.MkdirTemp("", "poster-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	output := filepath.Join(tmpDir, "poster.jpg")
+	_, err = s.exec.Run(ctx, s.ffmpeg,
+		"-v", "error",
+		"-y",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "3",
+		output,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return "", fmt.Errorf("poster não gerado: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	stem := strings.TrimSuffix(media.Filename, path.Ext(media.Filename))
+	// Cada processamento usa uma chave nova (ver variantKey)
+	key := path.Join("posters", strconv.Itoa(media.ID), uuid.New().String(), stem+".jpg")
+	if err := s.storage.Put(ctx, key, file, stat.Size(), "image/jpeg"); err != nil {
+		return "", fmt.Errorf("erro ao gravar poster: %w", err)
+	}
+
+	return key, nil
+}
+
+// localPather é implementado por backends que guardam os arquivos em disco
+type localPather interface {
+	Path(key string) string
+}
+
+// localCopy retorna um caminho no disco com o conteúdo do objeto, baixando-o
+// para um arquivo temporário quando o backend não é local
+func localCopy(ctx context.Context, store storage.Backend, key string) (string, func(), error) {
+	if local, ok := store.(localPather); ok {
+		return local.Path(key), func() {}, nil
+	}
+
+	reader, _, err := store.Get(ctx, key)
+	if err != nil {
+		return "", nil, fmt.Errorf("erro ao abrir original: %w", err)
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "media-*"+path.Ext(key))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("erro ao baixar original: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return tmp.Name(), cleanup, nil
+}
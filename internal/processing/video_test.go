@@ -0,0 +1,295 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/storage"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// fakeExecutor responde às chamadas de ffprobe e ffmpeg sem executar os
+// programas, registrando os argumentos recebidos
+type fakeExecutor struct {
+	programs map[string]func(args []string) ([]byte, error)
+	calls    [][]string
+}
+
+func (e *fakeExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	e.calls = append(e.calls, append([]string{name}, args...))
+	run, ok := e.programs[name]
+	if !ok {
+		return nil, errors.New(name + ": programa não esperado")
+	}
+	return run(args)
+}
+
+// respond retorna sempre a mesma saída
+func respond(out string, err error) func([]string) ([]byte, error) {
+	return func([]string) ([]byte, error) {
+		if err != nil {
+			return nil, err
+		}
+		return []byte(out), nil
+	}
+}
+
+// writePoster simula o ffmpeg gravando o quadro no arquivo de saída (último argumento)
+func writePoster(content string) func([]string) ([]byte, error) {
+	return func(args []string) ([]byte, error) {
+		return nil, os.WriteFile(args[len(args)-1], []byte(content), 0644)
+	}
+}
+
+// argAfter retorna o valor que segue a flag nos argumentos de uma chamada
+func argAfter(call []string, flag string) string {
+	for i := 0; i < len(call)-1; i++ {
+		if call[i] == flag {
+			return call[i+1]
+		}
+	}
+	return ""
+}
+
+func newTestVideoStep(t *testing.T, exec Executor) (*VideoProbeStep, *storage.Local) {
+	t.Helper()
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVideoProbeStep(store, nil, exec, "ffprobe", "ffmpeg"), store
+}
+
+// storedKeys lista as chaves gravadas abaixo do prefixo
+func storedKeys(t *testing.T, store *storage.Local, prefix string) []string {
+	t.Helper()
+	var keys []string
+	root := store.Path("")
+	err := filepath.WalkDir(store.Path(prefix), func(p string, d os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		keys = append(keys, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestVideoProbeStepProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		want    models.VideoInfo
+		wantErr string
+	}{
+		{
+			name: "faixa de vídeo depois da de áudio",
+			output: `{"streams":[
+				{"codec_type":"audio","codec_name":"aac","duration":"12.0"},
+				{"codec_type":"video","codec_name":"h264","width":1920,"height":1080,"duration":"12.0"}
+			],"format":{"duration":"12.480000"}}`,
+			want: models.VideoInfo{Duration: 12.48, Width: 1920, Height: 1080, VideoCodec: "h264"},
+		},
+		{
+			name: "duração apenas na faixa",
+			output: `{"streams":[
+				{"codec_type":"video","codec_name":"vp9","width":640,"height":360,"duration":"3.5"}
+			],"format":{}}`,
+			want: models.VideoInfo{Duration: 3.5, Width: 640, Height: 360, VideoCodec: "vp9"},
+		},
+		{
+			name:    "sem faixa de vídeo",
+			output:  `{"streams":[{"codec_type":"audio","codec_name":"mp3"}],"format":{"duration":"5"}}`,
+			wantErr: "nenhuma faixa de vídeo",
+		},
+		{
+			name:    "saída inválida",
+			output:  `not json`,
+			wantErr: "saída inválida do ffprobe",
+		},
+		{
+			name:    "falha do ffprobe",
+			err:     errors.New("ffprobe: exit status 1: Invalid data found"),
+			wantErr: "Invalid data found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExecutor{programs: map[string]func([]string) ([]byte, error){
+				"ffprobe": respond(tt.output, tt.err),
+			}}
+			step, _ := newTestVideoStep(t, exec)
+
+			info, err := step.probe(context.Background(), "/tmp/clip.mp4")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("erro = %v, esperado contendo %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if *info != tt.want {
+				t.Errorf("info = %+v, esperado %+v", *info, tt.want)
+			}
+
+			call := exec.calls[0]
+			if call[0] != "ffprobe" || call[len(call)-1] != "/tmp/clip.mp4" || argAfter(call, "-print_format") != "json" {
+				t.Errorf("chamada inesperada: %v", call)
+			}
+		})
+	}
+}
+
+func TestVideoProbeStepPoster(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   float64
+		ffmpeg     func([]string) ([]byte, error)
+		wantOffset string
+		wantErr    string
+	}{
+		{
+			name:       "quadro depois do primeiro segundo",
+			duration:   10,
+			ffmpeg:     writePoster("jpeg"),
+			wantOffset: "1.000",
+		},
+		{
+			name:       "vídeo curto usa o meio",
+			duration:   1,
+			ffmpeg:     writePoster("jpeg"),
+			wantOffset: "0.500",
+		},
+		{
+			name:     "falha do ffmpeg",
+			duration: 10,
+			ffmpeg:   respond("", errors.New("ffmpeg: exit status 1")),
+			wantErr:  "exit status 1",
+		},
+		{
+			name:     "ffmpeg sem saída",
+			duration: 10,
+			ffmpeg:   respond("", nil),
+			wantErr:  "poster não gerado",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExecutor{programs: map[string]func([]string) ([]byte, error){"ffmpeg": tt.ffmpeg}}
+			step, store := newTestVideoStep(t, exec)
+			media := &models.Media{ID: 7, Filename: "clip.mov"}
+
+			key, err := step.poster(context.Background(), media, "/tmp/clip.mov", tt.duration)
+			if got := argAfter(exec.calls[0], "-ss"); tt.wantOffset != "" && got != tt.wantOffset {
+				t.Errorf("offset = %s, esperado %s", got, tt.wantOffset)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("erro = %v, esperado contendo %q", err, tt.wantErr)
+				}
+				if keys := storedKeys(t, store, "posters"); len(keys) > 0 {
+					t.Errorf("nenhum poster deveria ser gravado: %v", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+
+			// posters/<id>/<geração>/<nome>.jpg
+			parts := strings.Split(key, "/")
+			if len(parts) != 4 || parts[0] != "posters" || parts[1] != "7" || parts[3] != "clip.jpg" {
+				t.Fatalf("chave = %s, esperado posters/7/<geração>/clip.jpg", key)
+			}
+			if _, err := uuid.Parse(parts[2]); err != nil {
+				t.Errorf("geração %q não é um UUID", parts[2])
+			}
+
+			reader, info, err := store.Get(context.Background(), key)
+			if err != nil {
+				t.Fatalf("poster não gravado: %v", err)
+			}
+			defer reader.Close()
+			content, _ := io.ReadAll(reader)
+			if string(content) != "jpeg" || info.Size != 4 {
+				t.Errorf("conteúdo = %q (%d bytes), esperado o quadro gerado", content, info.Size)
+			}
+
+			// Um novo processamento nunca reaproveita a chave
+			again, err := step.poster(context.Background(), media, "/tmp/clip.mov", tt.duration)
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if again == key || path.Dir(again) == path.Dir(key) {
+				t.Errorf("chave reaproveitada: %s", again)
+			}
+		})
+	}
+}
+
+func TestVideoProbeStepProcessFailure(t *testing.T) {
+	probe := `{"streams":[{"codec_type":"video","codec_name":"h264","width":320,"height":240}],"format":{"duration":"4"}}`
+
+	tests := []struct {
+		name     string
+		programs map[string]func([]string) ([]byte, error)
+		wantErr  string
+	}{
+		{
+			name: "falha do ffprobe",
+			programs: map[string]func([]string) ([]byte, error){
+				"ffprobe": respond("", errors.New("ffprobe: exit status 1: moov atom not found")),
+			},
+			wantErr: "moov atom not found",
+		},
+		{
+			name: "falha do poster",
+			programs: map[string]func([]string) ([]byte, error){
+				"ffprobe": respond(probe, nil),
+				"ffmpeg":  respond("", errors.New("ffmpeg: exit status 1")),
+			},
+			wantErr: "ffmpeg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, store := newTestVideoStep(t, &fakeExecutor{programs: tt.programs})
+			if err := store.Put(context.Background(), "videos/clip.mp4", strings.NewReader("mp4"), 3, "video/mp4"); err != nil {
+				t.Fatal(err)
+			}
+			media := &models.Media{ID: 3, Filename: "clip.mp4", FilePath: "videos/clip.mp4", MediaType: models.MediaTypeVideo}
+
+			// A falha acontece antes de qualquer gravação no banco
+			err := step.Process(context.Background(), media)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("erro = %v, esperado contendo %q", err, tt.wantErr)
+			}
+			if media.Duration != nil || media.PosterPath != nil {
+				t.Errorf("mídia alterada após a falha: %+v", media)
+			}
+			if keys := storedKeys(t, store, "posters"); len(keys) > 0 {
+				t.Errorf("nenhum poster deveria ser gravado: %v", keys)
+			}
+		})
+	}
+}
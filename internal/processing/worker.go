@@ -0,0 +1,141 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"multi-upload-api/internal/models"
+	"multi-upload-api/internal/repository"
+	"sync"
+	"time"
+)
+
+// Step é uma etapa do processamento de mídia executada em segundo plano
+type Step interface {
+	// Name identifica a etapa nos logs
+	Name() string
+	// Applies indica se a etapa deve ser executada para a mídia
+	Applies(media *models.Media) bool
+	// Process executa a etapa. A mídia pode ser alterada pela etapa.
+	Process(ctx context.Context, media *models.Media) error
+}
+
+// sweepInterval define de quanto em quanto tempo as mídias pendentes são
+// buscadas no banco, cobrindo jobs perdidos em reinícios ou com a fila cheia
+const sweepInterval = time.Minute
+
+// Worker executa as etapas de processamento para as mídias enfileiradas
+type Worker struct {
+	mediaRepo *repository.MediaRepository
+	steps     []Step
+	workers   int
+	queue     chan int
+
+	mu       sync.Mutex
+	inFlight map[int]bool
+}
+
+func NewWorker(mediaRepo *repository.MediaRepository, workers int, steps ...Step) *Worker {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Worker{
+		mediaRepo: mediaRepo,
+		steps:     steps,
+		workers:   workers,
+		queue:     make(chan int, 256),
+		inFlight:  make(map[int]bool),
+	}
+}
+
+// Start inicia as goroutines de processamento até que ctx seja cancelado
+func (w *Worker) Start(ctx context.Context) {
+	for i := 0; i < w.workers; i++ {
+		go w.run(ctx)
+	}
+	go w.sweep(ctx)
+}
+
+// Enqueue agenda o processamento de uma mídia. Não bloqueia: se a fila
+// estiver cheia a mídia será encontrada na próxima varredura.
+func (w *Worker) Enqueue(mediaID int) {
+	w.mu.Lock()
+	if w.inFlight[mediaID] {
+		w.mu.Unlock()
+		return
+	}
+	w.inFlight[mediaID] = true
+	w.mu.Unlock()
+
+	select {
+	case w.queue <- mediaID:
+	default:
+		w.done(mediaID)
+		log.Printf("[Processing] fila cheia, mídia %d será processada na próxima varredura", mediaID)
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mediaID := <-w.queue:
+			w.process(ctx, mediaID)
+			w.done(mediaID)
+		}
+	}
+}
+
+func (w *Worker) sweep(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := w.mediaRepo.ListUnprocessed(cap(w.queue))
+		if err != nil {
+			log.Printf("[Processing] erro ao buscar mídias pendentes: %v", err)
+		}
+		for _, id := range ids {
+			w.Enqueue(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process executa todas as etapas aplicáveis. Falhas de uma etapa são
+// registradas em log e não impedem as demais; ao final a mídia é marcada
+// como processada para não ser reprocessada indefinidamente.
+func (w *Worker) process(ctx context.Context, mediaID int) {
+	media, err := w.mediaRepo.FindByID(mediaID)
+	if err != nil {
+		log.Printf("[Processing] mídia %d não encontrada: %v", mediaID, err)
+		return
+	}
+	if media.ProcessedAt != nil {
+		return
+	}
+
+	for _, step := range w.steps {
+		if !step.Applies(media) {
+			continue
+		}
+		if err := step.Process(ctx, media); err != nil {
+			log.Printf("[Processing] erro na etapa %s da mídia %d: %v", step.Name(), mediaID, err)
+		}
+	}
+
+	if err := w.mediaRepo.MarkProcessed(mediaID, media.FilePath); err != nil {
+		log.Printf("[Processing] erro ao finalizar mídia %d: %v", mediaID, err)
+	}
+}
+
+func (w *Worker) done(mediaID int) {
+	w.mu.Lock()
+	delete(w.inFlight, mediaID)
+	w.mu.Unlock()
+}
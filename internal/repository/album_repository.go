@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"multi-upload-api/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrSlugTaken indica que já existe um álbum com o slug informado
+var ErrSlugTaken = errors.New("slug já está em uso")
+
+type AlbumRepository struct {
+	db *sql.DB
+}
+
+// albumColumns lista as colunas lidas em todas as consultas de álbum, na
+// ordem esperada por scanAlbum
+const albumColumns = `id, user_id, title, slug, description, cover_media_id,
+	(SELECT COUNT(*) FROM album_media am JOIN media m ON m.id = am.media_id
+	 WHERE am.album_id = albums.id AND m.deleted_at IS NULL) AS media_count,
+	created_at, updated_at`
+
+func scanAlbum(row rowScanner, album *models.Album) error {
+	return row.Scan(
+		&album.ID, &album.UserID, &album.Title, &album.Slug, &album.Description,
+		&album.CoverMediaID, &album.MediaCount, &album.CreatedAt, &album.UpdatedAt,
+	)
+}
+
+func NewAlbumRepository(db *sql.DB) *AlbumRepository {
+	return &AlbumRepository{db: db}
+}
+
+// Create cria um novo álbum. Retorna ErrSlugTaken se o slug já existir.
+func (r *AlbumRepository) Create(album *models.Album) error {
+	query := `INSERT INTO albums (user_id, title, slug, description, cover_media_id)
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id, created_at, updated_at`
+
+	err := r.db.QueryRow(query, album.UserID, album.Title, album.Slug, album.Description, album.CoverMediaID).Scan(
+		&album.ID, &album.CreatedAt, &album.UpdatedAt,
+	)
+	return slugError(err)
+}
+
+// GetByID busca um álbum do usuário
+func (r *AlbumRepository) GetByID(id int, userID int) (*models.Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE id = $1 AND user_id = $2`
+
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRow(query, id, userID), album); err != nil {
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// FindByID busca um álbum de qualquer usuário. O controle de acesso fica a
+// cargo de quem chama.
+func (r *AlbumRepository) FindByID(id int) (*models.Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE id = $1`
+
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRow(query, id), album); err != nil {
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// GetBySlug busca um álbum pelo slug (para a galeria pública)
+func (r *AlbumRepository) GetBySlug(slug string) (*models.Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE slug = $1`
+
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRow(query, slug), album); err != nil {
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// List lista os álbuns do usuário, do mais recente para o mais antigo. Com
+// shared, inclui também os álbuns dos demais usuários que tenham ao menos
+// uma mídia (fora da lixeira) com uma dessas visibilidades.
+func (r *AlbumRepository) List(userID int, shared []models.Visibility) ([]models.Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE user_id = $1
+			  OR EXISTS (SELECT 1 FROM album_media am JOIN media m ON m.id = am.media_id
+			             WHERE am.album_id = albums.id AND m.deleted_at IS NULL AND m.visibility = ANY($2))
+			  ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, userID, visibilityArray(shared))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albums := []models.Album{}
+	for rows.Next() {
+		var album models.Album
+		if err := scanAlbum(rows, &album); err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+
+	return albums, rows.Err()
+}
+
+// Update atualiza os dados de um álbum. Retorna ErrSlugTaken se o novo slug
+// já existir.
+func (r *AlbumRepository) Update(album *models.Album) error {
+	query := `UPDATE albums SET title = $1, slug = $2, description = $3, cover_media_id = $4
+			  WHERE id = $5 AND user_id = $6
+			  RETURNING updated_at`
+
+	err := r.db.QueryRow(query, album.Title, album.Slug, album.Description, album.CoverMediaID,
+		album.ID, album.UserID).Scan(&album.UpdatedAt)
+	return slugError(err)
+}
+
+// Delete exclui um álbum. As mídias continuam existindo.
+func (r *AlbumRepository) Delete(id int, userID int) error {
+	query := `DELETE FROM albums WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// AddMedia adiciona mídias do usuário ao final do álbum, na ordem informada.
+// Mídias de outros usuários ou que já fazem parte do álbum são ignoradas.
+// Retorna a quantidade de mídias adicionadas.
+func (r *AlbumRepository) AddMedia(albumID int, userID int, mediaIDs []int) (int, error) {
+	ids := make([]int64, len(mediaIDs))
+	for i, id := range mediaIDs {
+		ids[i] = int64(id)
+	}
+
+	query := `INSERT INTO album_media (album_id, media_id, sort_order)
+			  SELECT $1, m.id,
+			         (SELECT COALESCE(MAX(sort_order), 0) FROM album_media WHERE album_id = $1) + ids.ord
+			  FROM unnest($2::int[]) WITH ORDINALITY AS ids(media_id, ord)
+			  JOIN media m ON m.id = ids.media_id AND m.user_id = $3 AND m.deleted_at IS NULL
+			  ON CONFLICT (album_id, media_id) DO NOTHING`
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, albumID, pq.Array(ids), userID)
+	if err != nil {
+		return 0, err
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, albumID); err != nil {
+		return 0, err
+	}
+
+	return int(added), tx.Commit()
+}
+
+// RemoveMedia remove uma mídia do álbum (a mídia não é excluída)
+func (r *AlbumRepository) RemoveMedia(albumID int, mediaID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM album_media WHERE album_id = $1 AND media_id = $2`, albumID, mediaID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, albumID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateSortOrders atualiza a ordem das mídias dentro do álbum
+func (r *AlbumRepository) UpdateSortOrders(albumID int, mediaIDs []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE album_media SET sort_order = $1 WHERE album_id = $2 AND media_id = $3`
+
+	for i, mediaID := range mediaIDs {
+		if _, err := tx.Exec(query, i+1, albumID, mediaID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, albumID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// slugError converte a violação da restrição UNIQUE do slug em ErrSlugTaken
+func slugError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "albums_slug_key" {
+		return ErrSlugTaken
+	}
+	return err
+}
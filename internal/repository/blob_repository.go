@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// BlobRepository controla as referências aos conteúdos armazenados no layout
+// endereçado por conteúdo. Cada mídia e cada versão que aponta para um blob
+// conta como uma referência; o arquivo só é removido quando não resta nenhuma.
+type BlobRepository struct {
+	db *sql.DB
+}
+
+func NewBlobRepository(db *sql.DB) *BlobRepository {
+	return &BlobRepository{db: db}
+}
+
+// Acquire registra uma nova referência ao blob. place é executado com a
+// linha do blob bloqueada e recebe created=true quando o blob ainda não
+// existia (o conteúdo deve ser colocado em key) ou false quando já existia
+// (o conteúdo recebido é redundante). Se place falhar a referência não é
+// registrada.
+func (r *BlobRepository) Acquire(checksum, key string, size int64, place func(created bool) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// xmax = 0 identifica uma linha recém-inserida (sem conflito)
+	query := `INSERT INTO blobs (checksum, file_path, file_size, ref_count) VALUES ($1, $2, $3, 1)
+			  ON CONFLICT (checksum) DO UPDATE SET ref_count = blobs.ref_count + 1
+			  RETURNING (xmax = 0)`
+
+	var created bool
+	if err := tx.QueryRow(query, checksum, key, size).Scan(&created); err != nil {
+		return err
+	}
+
+	if err := place(created); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Release remove uma referência ao blob. Quando não resta nenhuma, o
+// registro é apagado e remove é executado, ainda com a linha bloqueada, para
+// excluir o arquivo; se remove falhar nada é alterado.
+func (r *BlobRepository) Release(checksum string, remove func(key string) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key, unreferenced, err := releaseBlob(tx, checksum)
+	if err != nil {
+		return err
+	}
+	if unreferenced {
+		if err := remove(key); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// releaseBlob remove, na transação tx, uma referência ao blob. Quando não
+// resta nenhuma, o registro é apagado e a chave do arquivo é retornada com
+// unreferenced=true, para que o chamador o exclua.
+func releaseBlob(tx *sql.Tx, checksum string) (key string, unreferenced bool, err error) {
+	var refCount int
+	query := `UPDATE blobs SET ref_count = ref_count - 1 WHERE checksum = $1 RETURNING ref_count, file_path`
+	if err := tx.QueryRow(query, checksum).Scan(&refCount, &key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if refCount > 0 {
+		return key, false, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM blobs WHERE checksum = $1`, checksum); err != nil {
+		return "", false, err
+	}
+	return key, true, nil
+}
+
+// BlobRecord é um blob registrado, com a quantidade de referências que
+// realmente existem no banco (mídias e versões com o mesmo checksum)
+type BlobRecord struct {
+	Checksum   string
+	FilePath   string
+	FileSize   int64
+	RefCount   int
+	References int
+}
+
+// List retorna todos os blobs registrados com suas referências reais
+func (r *BlobRepository) List() ([]BlobRecord, error) {
+	query := `SELECT b.checksum, b.file_path, b.file_size, b.ref_count,
+			  (SELECT COUNT(*) FROM media m WHERE m.checksum = b.checksum) +
+			  (SELECT COUNT(*) FROM media_versions v WHERE v.checksum = b.checksum)
+			  FROM blobs b ORDER BY b.checksum`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs []BlobRecord
+	for rows.Next() {
+		var blob BlobRecord
+		if err := rows.Scan(&blob.Checksum, &blob.FilePath, &blob.FileSize, &blob.RefCount, &blob.References); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+
+	return blobs, rows.Err()
+}
+
+// Reconcile ajusta o contador do blob às referências que existem no banco,
+// criando o registro se ele estiver faltando. Sem referências, o registro é
+// apagado. Retorna a quantidade de referências encontradas.
+func (r *BlobRepository) Reconcile(checksum, key string, size int64) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO blobs (checksum, file_path, file_size, ref_count) VALUES ($1, $2, $3, 0)
+					  ON CONFLICT (checksum) DO NOTHING`, checksum, key, size)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`SELECT 1 FROM blobs WHERE checksum = $1 FOR UPDATE`, checksum); err != nil {
+		return 0, err
+	}
+
+	var references int
+	query := `SELECT (SELECT COUNT(*) FROM media WHERE checksum = $1) +
+			  (SELECT COUNT(*) FROM media_versions WHERE checksum = $1)`
+	if err := tx.QueryRow(query, checksum).Scan(&references); err != nil {
+		return 0, err
+	}
+
+	if references == 0 {
+		_, err = tx.Exec(`DELETE FROM blobs WHERE checksum = $1`, checksum)
+	} else {
+		_, err = tx.Exec(`UPDATE blobs SET ref_count = $1 WHERE checksum = $2`, references, checksum)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return references, tx.Commit()
+}
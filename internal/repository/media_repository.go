@@ -2,21 +2,62 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"multi-upload-api/internal/models"
+	"path"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrQuotaExceeded indica que a gravação ultrapassaria a cota do usuário
+var ErrQuotaExceeded = errors.New("cota de armazenamento excedida")
+
 type MediaRepository struct {
 	db *sql.DB
 }
 
+// mediaColumns lista as colunas lidas em todas as consultas de mídia, na
+// ordem esperada por scanMedia
+const mediaColumns = `id, user_id, filename, original_name, file_path, file_size, checksum,
+	mime_type, media_type, sort_order, visibility, title, description, alt_text, duration, width, height, video_codec, poster_path,
+	processed_at, deleted_at, broken_at, broken_reason, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMedia(row rowScanner, media *models.Media) error {
+	return row.Scan(
+		&media.ID, &media.UserID, &media.Filename, &media.OriginalName,
+		&media.FilePath, &media.FileSize, &media.Checksum, &media.MimeType, &media.MediaType,
+		&media.SortOrder, &media.Visibility, &media.Title, &media.Description, &media.AltText, &media.Duration, &media.Width, &media.Height, &media.VideoCodec,
+		&media.PosterPath, &media.ProcessedAt, &media.DeletedAt, &media.BrokenAt, &media.BrokenReason, &media.CreatedAt, &media.UpdatedAt,
+	)
+}
+
 func NewMediaRepository(db *sql.DB) *MediaRepository {
 	return &MediaRepository{db: db}
 }
 
 // Create cria um novo registro de mídia (sempre em primeiro lugar)
-func (r *MediaRepository) Create(media *models.Media) error {
+func (r *MediaRepository) Create(media *models.Media, defaults models.Quota) error {
+	return r.CreateBatch([]*models.Media{media}, defaults)
+}
+
+// CreateBatch cria vários registros de mídia em uma única transação. Os
+// arquivos existentes do usuário são deslocados uma única vez e os novos
+// ocupam as primeiras posições, na ordem em que foram enviados. Retorna
+// ErrQuotaExceeded, sem criar nenhum, se eles não couberem na cota dos
+// usuários (defaults vale para quem não tem cota própria).
+func (r *MediaRepository) CreateBatch(medias []*models.Media, defaults models.Quota) error {
+	if len(medias) == 0 {
+		return nil
+	}
+
 	// Iniciar transação para garantir consistência
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -24,57 +65,201 @@ func (r *MediaRepository) Create(media *models.Media) error {
 	}
 	defer tx.Rollback()
 
-	// Incrementar sort_order de todos os arquivos existentes do usuário
-	_, err = tx.Exec(`UPDATE media SET sort_order = sort_order + 1 WHERE user_id = $1`, media.UserID)
+	quotas, err := lockQuotas(tx, medias, defaults)
 	if err != nil {
 		return err
 	}
+	if err := insertMedia(tx, medias); err != nil {
+		return err
+	}
+	if err := quotas.check(tx); err != nil {
+		return err
+	}
 
-	// Inserir novo arquivo com sort_order = 1 (primeiro lugar)
-	query := `INSERT INTO media (user_id, filename, original_name, file_path, file_size, mime_type, media_type, sort_order)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, 1)
-			  RETURNING id, sort_order, created_at, updated_at`
+	// Commit da transação
+	return tx.Commit()
+}
 
-	err = tx.QueryRow(query, media.UserID, media.Filename, media.OriginalName,
-		media.FilePath, media.FileSize, media.MimeType, media.MediaType).Scan(
-		&media.ID, &media.SortOrder, &media.CreatedAt, &media.UpdatedAt,
-	)
+// CreateFromUpload cria a mídia de um upload resumível concluído e a associa
+// ao upload na mesma transação. Retorna ErrUploadFinished se o upload já
+// tiver uma mídia (ou não existir mais), sem criar outra, e ErrQuotaExceeded
+// se ela não couber na cota do usuário.
+func (r *MediaRepository) CreateFromUpload(media *models.Media, uploadID string, defaults models.Quota) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	medias := []*models.Media{media}
+	quotas, err := lockQuotas(tx, medias, defaults)
+	if err != nil {
+		return err
+	}
+	if err := insertMedia(tx, medias); err != nil {
+		return err
+	}
+	if err := quotas.check(tx); err != nil {
+		return err
+	}
+
+	// O offset final é gravado apenas aqui: enquanto a mídia não existir o
+	// upload continua incompleto para o cliente (ver TusHandler.Patch)
+	query := `UPDATE tus_uploads SET media_id = $1, upload_offset = upload_length
+			  WHERE id = $2 AND media_id IS NULL`
+	if err := execOne(tx, query, media.ID, uploadID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUploadFinished
+		}
+		return err
+	}
 
-	// Commit da transação
 	return tx.Commit()
 }
 
-// GetByID busca mídia por ID
+// insertMedia insere as mídias nas primeiras posições de seus usuários
+func insertMedia(tx *sql.Tx, medias []*models.Media) error {
+	// Deslocar sort_order de todos os arquivos existentes de cada usuário
+	shifts := make(map[int]int)
+	for _, media := range medias {
+		shifts[media.UserID]++
+	}
+	for userID, count := range shifts {
+		_, err := tx.Exec(`UPDATE media SET sort_order = sort_order + $1 WHERE user_id = $2`, count, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO media (user_id, filename, original_name, file_path, file_size, checksum, mime_type, media_type, sort_order, visibility)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			  RETURNING id, sort_order, created_at, updated_at`
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	positions := make(map[int]int)
+	for _, media := range medias {
+		positions[media.UserID]++
+		// Sem visibilidade informada, a mídia nunca é exposta por engano
+		if media.Visibility == "" {
+			media.Visibility = models.VisibilityPrivate
+		}
+		err := stmt.QueryRow(media.UserID, media.Filename, media.OriginalName,
+			media.FilePath, media.FileSize, media.Checksum, media.MimeType, media.MediaType,
+			positions[media.UserID], media.Visibility).Scan(
+			&media.ID, &media.SortOrder, &media.CreatedAt, &media.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		media.Tags = []string{}
+		media.Variants = []models.MediaVariant{}
+		media.Renditions = []models.MediaRendition{}
+	}
+
+	return nil
+}
+
+// GetByID busca mídia por ID (mídias na lixeira não são retornadas)
 func (r *MediaRepository) GetByID(id int, userID int) (*models.Media, error) {
-	query := `SELECT id, user_id, filename, original_name, file_path, file_size, 
-			  mime_type, media_type, sort_order, created_at, updated_at
-			  FROM media WHERE id = $1 AND user_id = $2`
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
 
 	media := &models.Media{}
-	err := r.db.QueryRow(query, id, userID).Scan(
-		&media.ID, &media.UserID, &media.Filename, &media.OriginalName,
-		&media.FilePath, &media.FileSize, &media.MimeType, &media.MediaType,
-		&media.SortOrder, &media.CreatedAt, &media.UpdatedAt,
-	)
+	if err := scanMedia(r.db.QueryRow(query, id, userID), media); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := r.attachDetails([]*models.Media{media}); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// MediaScope define as mídias que um usuário consulta: as próprias e, quando
+// Shared é informado, as de qualquer usuário com uma dessas visibilidades
+type MediaScope struct {
+	UserID int
+	Shared []models.Visibility
+}
+
+// condition retorna a condição SQL do escopo, com os parâmetros numerados a
+// partir de first, e os valores correspondentes
+func (s MediaScope) condition(first int) (string, []interface{}) {
+	if len(s.Shared) == 0 {
+		return fmt.Sprintf("user_id = $%d", first), []interface{}{s.UserID}
+	}
+	return fmt.Sprintf("(user_id = $%d OR visibility = ANY($%d))", first, first+1),
+		[]interface{}{s.UserID, visibilityArray(s.Shared)}
+}
+
+func visibilityArray(visibilities []models.Visibility) interface{} {
+	values := make([]string, len(visibilities))
+	for i, visibility := range visibilities {
+		values[i] = string(visibility)
+	}
+	return pq.Array(values)
+}
+
+// GetInScope busca uma mídia fora da lixeira, com variantes e rendições,
+// desde que ela esteja no escopo informado
+func (r *MediaRepository) GetInScope(id int, scope MediaScope) (*models.Media, error) {
+	condition, args := scope.condition(2)
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1 AND ` + condition + ` AND deleted_at IS NULL`
+
+	media := &models.Media{}
+	if err := scanMedia(r.db.QueryRow(query, append([]interface{}{id}, args...)...), media); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachDetails([]*models.Media{media}); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// FindActiveByID busca uma mídia fora da lixeira, de qualquer usuário, com
+// variantes e rendições. O controle de acesso fica a cargo de quem chama.
+func (r *MediaRepository) FindActiveByID(id int) (*models.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1 AND deleted_at IS NULL`
+
+	media := &models.Media{}
+	if err := scanMedia(r.db.QueryRow(query, id), media); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachDetails([]*models.Media{media}); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// FindByID busca mídia por ID sem restringir ao usuário (uso interno)
+func (r *MediaRepository) FindByID(id int) (*models.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1`
+
+	media := &models.Media{}
+	if err := scanMedia(r.db.QueryRow(query, id), media); err != nil {
 		return nil, err
 	}
 
 	return media, nil
 }
 
-// List lista mídias com paginação e filtros
-func (r *MediaRepository) List(userID int, page, pageSize int, mediaType string, orderBy string) ([]models.Media, int, error) {
+// List lista as mídias do escopo com paginação e filtros
+func (r *MediaRepository) List(scope MediaScope, page, pageSize int, mediaType, tag string, orderBy string) ([]models.Media, int, error) {
 	offset := (page - 1) * pageSize
 
 	// Construir query base
-	baseQuery := `FROM media WHERE user_id = $1`
-	args := []interface{}{userID}
-	argCount := 1
+	condition, args := scope.condition(1)
+	baseQuery := `FROM media WHERE ` + condition + ` AND deleted_at IS NULL`
+	argCount := len(args)
 
 	// Adicionar filtro de tipo de mídia se especificado
 	if mediaType != "" {
@@ -83,6 +268,14 @@ func (r *MediaRepository) List(userID int, page, pageSize int, mediaType string,
 		args = append(args, mediaType)
 	}
 
+	// Adicionar filtro de tag se especificado
+	if tag != "" {
+		argCount++
+		baseQuery += fmt.Sprintf(` AND id IN (SELECT mt.media_id FROM media_tags mt
+			JOIN tags t ON t.id = mt.tag_id WHERE t.slug = $%d)`, argCount)
+		args = append(args, models.Slugify(tag))
+	}
+
 	// Construir ORDER BY (padrão: ordem personalizada - novos uploads ficam em primeiro)
 	orderClause := " ORDER BY sort_order ASC"
 	switch strings.ToLower(orderBy) {
@@ -110,8 +303,7 @@ func (r *MediaRepository) List(userID int, page, pageSize int, mediaType string,
 	}
 
 	// Query para buscar dados
-	dataQuery := `SELECT id, user_id, filename, original_name, file_path, file_size,
-				  mime_type, media_type, sort_order, created_at, updated_at ` +
+	dataQuery := `SELECT ` + mediaColumns + ` ` +
 		baseQuery + orderClause + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount+1, argCount+2)
 
 	args = append(args, pageSize, offset)
@@ -122,28 +314,20 @@ func (r *MediaRepository) List(userID int, page, pageSize int, mediaType string,
 	}
 	defer rows.Close()
 
-	var medias []models.Media
-	for rows.Next() {
-		var media models.Media
-		if err := rows.Scan(
-			&media.ID, &media.UserID, &media.Filename, &media.OriginalName,
-			&media.FilePath, &media.FileSize, &media.MimeType, &media.MediaType,
-			&media.SortOrder, &media.CreatedAt, &media.UpdatedAt,
-		); err != nil {
-			return nil, 0, err
-		}
-		medias = append(medias, media)
+	medias, err := r.scanMediaRows(rows)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	return medias, total, nil
 }
 
-// ListPublic lista todas as mídias publicamente (para galeria)
-func (r *MediaRepository) ListPublic(page, pageSize int, mediaType string, orderBy string) ([]models.Media, int, error) {
+// ListPublic lista as mídias públicas de todos os usuários (para galeria)
+func (r *MediaRepository) ListPublic(page, pageSize int, mediaType, tag string, orderBy string) ([]models.Media, int, error) {
 	offset := (page - 1) * pageSize
 
-	// Construir query base (sem filtro de usuário)
-	baseQuery := `FROM media WHERE 1=1`
+	// Construir query base (sem filtro de usuário, apenas mídias públicas)
+	baseQuery := `FROM media WHERE visibility = 'public' AND deleted_at IS NULL`
 	args := []interface{}{}
 	argCount := 0
 
@@ -154,6 +338,14 @@ func (r *MediaRepository) ListPublic(page, pageSize int, mediaType string, order
 		args = append(args, mediaType)
 	}
 
+	// Adicionar filtro de tag se especificado
+	if tag != "" {
+		argCount++
+		baseQuery += fmt.Sprintf(` AND id IN (SELECT mt.media_id FROM media_tags mt
+			JOIN tags t ON t.id = mt.tag_id WHERE t.slug = $%d)`, argCount)
+		args = append(args, models.Slugify(tag))
+	}
+
 	// Construir ORDER BY (padrão: ordem personalizada - novos uploads ficam em primeiro)
 	orderClause := " ORDER BY sort_order ASC"
 	switch strings.ToLower(orderBy) {
@@ -181,8 +373,7 @@ func (r *MediaRepository) ListPublic(page, pageSize int, mediaType string, order
 	}
 
 	// Query para buscar dados
-	dataQuery := `SELECT id, user_id, filename, original_name, file_path, file_size,
-				  mime_type, media_type, sort_order, created_at, updated_at ` +
+	dataQuery := `SELECT ` + mediaColumns + ` ` +
 		baseQuery + orderClause + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount+1, argCount+2)
 
 	args = append(args, pageSize, offset)
@@ -193,54 +384,1099 @@ func (r *MediaRepository) ListPublic(page, pageSize int, mediaType string, order
 	}
 	defer rows.Close()
 
-	var medias []models.Media
-	for rows.Next() {
-		var media models.Media
-		if err := rows.Scan(
-			&media.ID, &media.UserID, &media.Filename, &media.OriginalName,
-			&media.FilePath, &media.FileSize, &media.MimeType, &media.MediaType,
-			&media.SortOrder, &media.CreatedAt, &media.UpdatedAt,
-		); err != nil {
-			return nil, 0, err
-		}
-		medias = append(medias, media)
+	medias, err := r.scanMediaRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return medias, total, nil
+}
+
+// ListByAlbum lista as mídias de um álbum na ordem do álbum. Com visible,
+// apenas mídias com uma dessas visibilidades são retornadas (ex.: só as
+// públicas, para a galeria).
+func (r *MediaRepository) ListByAlbum(albumID int, page, pageSize int, visible []models.Visibility) ([]models.Media, int, error) {
+	offset := (page - 1) * pageSize
+
+	baseQuery := `FROM media JOIN (SELECT media_id, sort_order AS album_order FROM album_media
+		WHERE album_id = $1) am ON am.media_id = media.id
+		WHERE deleted_at IS NULL`
+	args := []interface{}{albumID}
+	if len(visible) > 0 {
+		baseQuery += ` AND visibility = ANY($2)`
+		args = append(args, visibilityArray(visible))
+	}
+
+	// Query para contar total
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) "+baseQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Query para buscar dados
+	dataQuery := `SELECT ` + mediaColumns + ` ` + baseQuery +
+		fmt.Sprintf(` ORDER BY am.album_order ASC, media.id ASC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(dataQuery, append(args, pageSize, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	medias, err := r.scanMediaRows(rows)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	return medias, total, nil
 }
 
+// ListByIDs busca várias mídias pelo ID, sem filtro de usuário (mídias na
+// lixeira são ignoradas)
+func (r *MediaRepository) ListByIDs(ids []int) ([]models.Media, error) {
+	if len(ids) == 0 {
+		return []models.Media{}, nil
+	}
+
+	values := make([]int64, len(ids))
+	for i, id := range ids {
+		values[i] = int64(id)
+	}
+
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = ANY($1) AND deleted_at IS NULL`
+
+	rows, err := r.db.Query(query, pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.scanMediaRows(rows)
+}
+
 // Update atualiza uma mídia
 func (r *MediaRepository) Update(media *models.Media) error {
-	query := `UPDATE media SET sort_order = $1, updated_at = CURRENT_TIMESTAMP
-			  WHERE id = $2 AND user_id = $3`
+	query := `UPDATE media SET sort_order = $1, visibility = $2, title = $3, description = $4,
+			  alt_text = $5, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $6 AND user_id = $7`
 
-	_, err := r.db.Exec(query, media.SortOrder, media.ID, media.UserID)
+	_, err := r.db.Exec(query, media.SortOrder, media.Visibility, media.Title, media.Description,
+		media.AltText, media.ID, media.UserID)
 	return err
 }
 
-// Delete exclui uma mídia
-func (r *MediaRepository) Delete(id int, userID int) error {
-	query := `DELETE FROM media WHERE id = $1 AND user_id = $2`
-	_, err := r.db.Exec(query, id, userID)
-	return err
+// SetTags substitui as tags de uma mídia. Tags inexistentes são criadas; tags
+// com o mesmo slug (ex.: "Guindaste" e "guindaste") são tratadas como iguais.
+func (r *MediaRepository) SetTags(mediaID int, names []string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM media_tags WHERE media_id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	upsert := `INSERT INTO tags (name, slug) VALUES ($1, $2)
+			   ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug
+			   RETURNING id, name`
+
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := models.Slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		var tagID int
+		var tagName string
+		if err := tx.QueryRow(upsert, name, slug).Scan(&tagID, &tagName); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`INSERT INTO media_tags (media_id, tag_id) VALUES ($1, $2)`, mediaID, tagID); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tagName)
+	}
+
+	// Atualizar updated_at para invalidar caches da mídia
+	if _, err := tx.Exec(`UPDATE media SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
 }
 
-// UpdateSortOrders atualiza a ordem de múltiplas mídias
-func (r *MediaRepository) UpdateSortOrders(userID int, mediaIDs []int) error {
+// FileRef identifica um arquivo original armazenado. Checksum é nulo para
+// arquivos gravados antes do armazenamento por conteúdo.
+type FileRef struct {
+	FilePath string
+	Checksum *string
+}
+
+// FileSwap é o resultado da troca do arquivo de uma mídia
+type FileSwap struct {
+	// Previous é o estado da mídia antes da troca, com as variantes
+	Previous *models.Media
+	// Obsolete lista os arquivos derivados (variantes e poster) que deixaram
+	// de ser usados e devem ser removidos do armazenamento após o commit
+	Obsolete []string
+	// ObsoleteDirs lista os diretórios das rendições HLS descartadas, a serem
+	// removidos por inteiro (playlist e segmentos)
+	ObsoleteDirs []string
+	// Released lista os arquivos originais que perderam uma referência (o
+	// anterior, sem histórico, e as versões além da retenção)
+	Released []FileRef
+}
+
+// mediaVersionColumns lista as colunas lidas nas consultas de versões, na
+// ordem esperada por scanMediaVersion
+const mediaVersionColumns = `id, media_id, filename, original_name, file_path, file_size,
+	checksum, mime_type, media_type, replaced_by, replaced_at`
+
+func scanMediaVersion(row rowScanner, version *models.MediaVersion) error {
+	return row.Scan(
+		&version.ID, &version.MediaID, &version.Filename, &version.OriginalName,
+		&version.FilePath, &version.FileSize, &version.Checksum, &version.MimeType, &version.MediaType,
+		&version.ReplacedBy, &version.ReplacedAt,
+	)
+}
+
+// ReplaceFile troca, em uma única transação, o arquivo de uma mídia pelo
+// informado em media (filename, original_name, file_path, file_size,
+// mime_type e media_type). O arquivo anterior é guardado como versão,
+// mantendo no máximo retention versões (0 desativa o histórico).
+func (r *MediaRepository) ReplaceFile(media *models.Media, replacedBy int, retention int, defaults models.Quota) (*FileSwap, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	query := `UPDATE media SET sort_order = $1, updated_at = CURRENT_TIMESTAMP 
-			  WHERE id = $2 AND user_id = $3`
+	quotas, err := lockQuotas(tx, []*models.Media{media}, defaults)
+	if err != nil {
+		return nil, err
+	}
+	swap, err := r.swapFile(tx, media, replacedBy, retention)
+	if err != nil {
+		return nil, err
+	}
+	if err := quotas.check(tx); err != nil {
+		return nil, err
+	}
 
-	for i, mediaID := range mediaIDs {
-		if _, err := tx.Exec(query, i+1, mediaID, userID); err != nil {
-			return err
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return swap, nil
+}
+
+// RestoreVersion torna uma versão anterior o arquivo atual da mídia. O
+// arquivo atual passa a ser uma versão, como em uma substituição.
+func (r *MediaRepository) RestoreVersion(mediaID int, userID int, versionID int, restoredBy int, retention int) (*FileSwap, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Bloquear a mídia antes da versão, na mesma ordem usada por ReplaceFile
+	var lockedID int
+	if err := tx.QueryRow(`SELECT id FROM media WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+		mediaID, userID).Scan(&lockedID); err != nil {
+		return nil, err
+	}
+
+	version := &models.MediaVersion{}
+	query := `DELETE FROM media_versions WHERE id = $1 AND media_id = $2 RETURNING ` + mediaVersionColumns
+	if err := scanMediaVersion(tx.QueryRow(query, versionID, mediaID), version); err != nil {
+		return nil, err
+	}
+
+	media := &models.Media{
+		ID:           mediaID,
+		UserID:       userID,
+		Filename:     version.Filename,
+		OriginalName: version.OriginalName,
+		FilePath:     version.FilePath,
+		FileSize:     version.FileSize,
+		Checksum:     version.Checksum,
+		MimeType:     version.MimeType,
+		MediaType:    version.MediaType,
+	}
+
+	swap, err := r.swapFile(tx, media, restoredBy, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return swap, nil
+}
+
+// swapFile grava as colunas de arquivo da mídia, descarta as variantes e os
+// dados de vídeo do arquivo anterior, marca a mídia para ser processada
+// novamente e guarda o arquivo anterior como versão
+func (r *MediaRepository) swapFile(tx *sql.Tx, media *models.Media, replacedBy int, retention int) (*FileSwap, error) {
+	// Bloquear a linha para que substituições simultâneas sejam serializadas
+	previous := &models.Media{}
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`
+	if err := scanMedia(tx.QueryRow(query, media.ID, media.UserID), previous); err != nil {
+		return nil, err
+	}
+
+	swap := &FileSwap{Previous: previous}
+
+	rows, err := tx.Query(`DELETE FROM media_variants WHERE media_id = $1 RETURNING file_path`, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var variant models.MediaVariant
+		if err := rows.Scan(&variant.FilePath); err != nil {
+			rows.Close()
+			return nil, err
 		}
+		previous.Variants = append(previous.Variants, variant)
+		swap.Obsolete = append(swap.Obsolete, variant.FilePath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if previous.PosterPath != nil {
+		swap.Obsolete = append(swap.Obsolete, *previous.PosterPath)
 	}
 
-	return tx.Commit()
+	rows, err = tx.Query(`DELETE FROM media_renditions WHERE media_id = $1 RETURNING playlist_path`, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var playlistPath string
+		if err := rows.Scan(&playlistPath); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		swap.ObsoleteDirs = append(swap.ObsoleteDirs, path.Dir(playlistPath)+"/")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	update := `UPDATE media SET filename = $1, original_name = $2, file_path = $3, file_size = $4,
+			   checksum = $5, mime_type = $6, media_type = $7, duration = NULL, width = NULL, height = NULL,
+			   video_codec = NULL, poster_path = NULL, processed_at = NULL, broken_at = NULL, broken_reason = NULL,
+			   updated_at = CURRENT_TIMESTAMP
+			   WHERE id = $8
+			   RETURNING updated_at`
+	err = tx.QueryRow(update, media.Filename, media.OriginalName, media.FilePath, media.FileSize,
+		media.Checksum, media.MimeType, media.MediaType, media.ID).Scan(&media.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if retention <= 0 {
+		swap.Released = append(swap.Released, FileRef{FilePath: previous.FilePath, Checksum: previous.Checksum})
+		return swap, nil
+	}
+
+	// Guardar o arquivo anterior como versão
+	insert := `INSERT INTO media_versions (media_id, filename, original_name, file_path, file_size,
+			   checksum, mime_type, media_type, replaced_by)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = tx.Exec(insert, previous.ID, previous.Filename, previous.OriginalName, previous.FilePath,
+		previous.FileSize, previous.Checksum, previous.MimeType, previous.MediaType, replacedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Descartar as versões mais antigas além da retenção
+	purge := `DELETE FROM media_versions WHERE media_id = $1 AND id NOT IN (
+				  SELECT id FROM media_versions WHERE media_id = $1
+				  ORDER BY replaced_at DESC, id DESC LIMIT $2)
+			  RETURNING file_path, checksum`
+	purged, err := tx.Query(purge, media.ID, retention)
+	if err != nil {
+		return nil, err
+	}
+	defer purged.Close()
+	for purged.Next() {
+		var ref FileRef
+		if err := purged.Scan(&ref.FilePath, &ref.Checksum); err != nil {
+			return nil, err
+		}
+		swap.Released = append(swap.Released, ref)
+	}
+
+	return swap, purged.Err()
+}
+
+// ListVersions lista as versões anteriores de uma mídia, da mais recente para a mais antiga
+func (r *MediaRepository) ListVersions(mediaID int) ([]models.MediaVersion, error) {
+	query := `SELECT ` + mediaVersionColumns + ` FROM media_versions
+			  WHERE media_id = $1 ORDER BY replaced_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.MediaVersion{}
+	for rows.Next() {
+		var version models.MediaVersion
+		if err := scanMediaVersion(rows, &version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// FindDuplicate retorna o ID de uma mídia do usuário (fora da lixeira) com
+// o mesmo conteúdo
+func (r *MediaRepository) FindDuplicate(userID int, checksum string) (int, error) {
+	query := `SELECT id FROM media WHERE user_id = $1 AND checksum = $2 AND deleted_at IS NULL
+			  ORDER BY id LIMIT 1`
+
+	var id int
+	err := r.db.QueryRow(query, userID, checksum).Scan(&id)
+	return id, err
+}
+
+// GetUsage soma o espaço ocupado pelas mídias do usuário, inclusive as que
+// estão na lixeira, e por suas versões anteriores
+func (r *MediaRepository) GetUsage(userID int) (*models.Usage, error) {
+	return queryUsage(r.db, userID)
+}
+
+// querier é implementado por *sql.DB e *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryUsage(db querier, userID int) (*models.Usage, error) {
+	query := `SELECT media_type, FALSE, deleted_at IS NOT NULL AS trashed, COUNT(*), COALESCE(SUM(file_size), 0)
+			  FROM media WHERE user_id = $1
+			  GROUP BY media_type, trashed
+			  UNION ALL
+			  SELECT v.media_type, TRUE, FALSE, COUNT(*), COALESCE(SUM(v.file_size), 0)
+			  FROM media_versions v JOIN media m ON m.id = v.media_id
+			  WHERE m.user_id = $1
+			  GROUP BY v.media_type`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &models.Usage{ByMediaType: map[models.MediaType]models.UsageTotals{}}
+	for rows.Next() {
+		var mediaType models.MediaType
+		var version, trashed bool
+		var totals models.UsageTotals
+		if err := rows.Scan(&mediaType, &version, &trashed, &totals.Files, &totals.Bytes); err != nil {
+			return nil, err
+		}
+
+		byType := usage.ByMediaType[mediaType]
+		byType.Bytes += totals.Bytes
+		usage.Bytes += totals.Bytes
+		switch {
+		case version:
+			// Versões ocupam espaço, mas não contam como arquivos
+			usage.Versions.Files += totals.Files
+			usage.Versions.Bytes += totals.Bytes
+		case trashed:
+			usage.Trash.Files += totals.Files
+			usage.Trash.Bytes += totals.Bytes
+			fallthrough
+		default:
+			byType.Files += totals.Files
+			usage.Files += totals.Files
+		}
+		usage.ByMediaType[mediaType] = byType
+	}
+
+	return usage, rows.Err()
+}
+
+// userQuota é a cota de um usuário bloqueado na transação e o uso dele antes
+// da gravação
+type userQuota struct {
+	userID int
+	quota  models.Quota
+	before *models.Usage
+}
+
+// quotaLocks são as cotas conferidas ao final de uma gravação
+type quotaLocks []userQuota
+
+// lockQuotas bloqueia as linhas dos donos das mídias, em ordem de ID, e lê a
+// cota e o uso de cada um. Gravações simultâneas do mesmo usuário passam a
+// ser serializadas até o commit, e o uso conferido em check já inclui as
+// mídias gravadas pelas demais.
+func lockQuotas(tx *sql.Tx, medias []*models.Media, defaults models.Quota) (quotaLocks, error) {
+	var userIDs []int
+	for _, media := range medias {
+		if !slices.Contains(userIDs, media.UserID) {
+			userIDs = append(userIDs, media.UserID)
+		}
+	}
+	slices.Sort(userIDs)
+
+	var locks quotaLocks
+	for _, userID := range userIDs {
+		var quotaBytes sql.NullInt64
+		var quotaFiles sql.NullInt32
+		err := tx.QueryRow(`SELECT quota_bytes, quota_files FROM users WHERE id = $1 FOR UPDATE`, userID).
+			Scan(&quotaBytes, &quotaFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		quota := defaults
+		if quotaBytes.Valid {
+			quota.Bytes = quotaBytes.Int64
+		}
+		if quotaFiles.Valid {
+			quota.Files = int(quotaFiles.Int32)
+		}
+		if quota.Bytes <= 0 && quota.Files <= 0 {
+			continue
+		}
+
+		before, err := queryUsage(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, userQuota{userID: userID, quota: quota, before: before})
+	}
+
+	return locks, nil
+}
+
+// check retorna ErrQuotaExceeded se, depois da gravação, algum usuário tiver
+// ultrapassado a cota. Um uso que já estava acima da cota (ex.: a cota foi
+// reduzida) só é recusado se tiver aumentado.
+func (locks quotaLocks) check(tx *sql.Tx) error {
+	for _, lock := range locks {
+		after, err := queryUsage(tx, lock.userID)
+		if err != nil {
+			return err
+		}
+		if lock.quota.Bytes > 0 && after.Bytes > lock.quota.Bytes && after.Bytes > lock.before.Bytes {
+			return ErrQuotaExceeded
+		}
+		if lock.quota.Files > 0 && after.Files > lock.quota.Files && after.Files > lock.before.Files {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// LastPublicChange retorna a quantidade de mídias da galeria pública e o
+// instante da última alteração em qualquer uma delas. Toda escrita em media
+// atualiza updated_at: uma mídia que entra na galeria traz o updated_at mais
+// recente e uma que sai reduz a contagem, então o par muda sempre que a
+// listagem pode ter mudado. É usado para validar caches (ETag) sem refazer a
+// consulta completa, apenas com o índice idx_media_public_updated_at.
+func (r *MediaRepository) LastPublicChange() (int, time.Time, error) {
+	var count int
+	var lastChange sql.NullTime
+	query := `SELECT COUNT(*), MAX(updated_at) FROM media WHERE visibility = 'public' AND deleted_at IS NULL`
+	err := r.db.QueryRow(query).Scan(&count, &lastChange)
+	return count, lastChange.Time, err
+}
+
+// Trash move uma mídia para a lixeira
+func (r *MediaRepository) Trash(id int, userID int) error {
+	query := `UPDATE media SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	return r.execOne(query, id, userID)
+}
+
+// Restore retira uma mídia da lixeira
+func (r *MediaRepository) Restore(id int, userID int) error {
+	query := `UPDATE media SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`
+	return r.execOne(query, id, userID)
+}
+
+// ListTrash lista as mídias do usuário na lixeira, das excluídas mais
+// recentemente para as mais antigas
+func (r *MediaRepository) ListTrash(userID int, page, pageSize int) ([]models.Media, int, error) {
+	offset := (page - 1) * pageSize
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM media WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	if err := r.db.QueryRow(countQuery, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE user_id = $1 AND deleted_at IS NOT NULL
+			  ORDER BY deleted_at DESC, id DESC LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.Query(query, userID, pageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	medias, err := r.scanMediaRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return medias, total, nil
+}
+
+// ListExpiredTrash retorna as mídias que estão na lixeira desde antes de
+// before, com as variantes, para a exclusão definitiva
+func (r *MediaRepository) ListExpiredTrash(before time.Time, limit int) ([]models.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE deleted_at < $1
+			  ORDER BY deleted_at LIMIT $2`
+
+	rows, err := r.db.Query(query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.scanMediaRows(rows)
+}
+
+// execOne executa um comando que deve afetar exatamente uma linha,
+// retornando sql.ErrNoRows caso contrário
+func (r *MediaRepository) execOne(query string, args ...interface{}) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete exclui uma mídia definitivamente
+func (r *MediaRepository) Delete(id int, userID int) error {
+	query := `DELETE FROM media WHERE id = $1 AND user_id = $2`
+	_, err := r.db.Exec(query, id, userID)
+	return err
+}
+
+// PurgeTrashed exclui definitivamente uma mídia que está na lixeira desde
+// antes de before e, na mesma transação, libera as referências do original e
+// das versões. Retorna as chaves dos arquivos que ficaram sem referência, a
+// serem removidos do armazenamento, ou purged=false, sem alterar nada, se a
+// mídia tiver sido restaurada (ou já excluída por outra instância) depois de
+// listada.
+func (r *MediaRepository) PurgeTrashed(id int, before time.Time) (keys []string, purged bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var original FileRef
+	query := `SELECT file_path, checksum FROM media
+			  WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at < $2
+			  FOR UPDATE`
+	if err := tx.QueryRow(query, id, before).Scan(&original.FilePath, &original.Checksum); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	refs := []FileRef{original}
+	rows, err := tx.Query(`SELECT file_path, checksum FROM media_versions WHERE media_id = $1`, id)
+	if err != nil {
+		return nil, false, err
+	}
+	for rows.Next() {
+		var ref FileRef
+		if err := rows.Scan(&ref.FilePath, &ref.Checksum); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	// As versões são excluídas em cascata
+	if _, err := tx.Exec(`DELETE FROM media WHERE id = $1`, id); err != nil {
+		return nil, false, err
+	}
+
+	for _, ref := range refs {
+		// Arquivos sem checksum, anteriores ao armazenamento por conteúdo,
+		// pertencem apenas a esta mídia
+		if ref.Checksum == nil || *ref.Checksum == "" {
+			keys = append(keys, ref.FilePath)
+			continue
+		}
+		key, unreferenced, err := releaseBlob(tx, *ref.Checksum)
+		if err != nil {
+			return nil, false, err
+		}
+		if unreferenced {
+			keys = append(keys, key)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return keys, true, nil
+}
+
+// UpdateSortOrders atualiza a ordem de múltiplas mídias
+func (r *MediaRepository) UpdateSortOrders(userID int, mediaIDs []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE media SET sort_order = $1, updated_at = CURRENT_TIMESTAMP 
+			  WHERE id = $2 AND user_id = $3`
+
+	for i, mediaID := range mediaIDs {
+		if _, err := tx.Exec(query, i+1, mediaID, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FileOwner descreve uma mídia (ou versão) que referencia um arquivo
+// armazenado. Com o armazenamento por conteúdo um mesmo arquivo pode ser
+// referenciado por várias mídias, inclusive de usuários diferentes.
+type FileOwner struct {
+	UserID     int
+	Visibility models.Visibility
+	// MimeType é preenchido quando o arquivo é o original (e não uma
+	// variante ou poster)
+	MimeType string
+}
+
+// ListFileOwners lista as mídias fora da lixeira que referenciam o arquivo,
+// seja como original, poster, variante ou arquivo de uma rendição HLS
+// (playlist ou segmento, no diretório da playlist). Versões anteriores são
+// retornadas como privadas, pois só podem ser acessadas pelo dono.
+func (r *MediaRepository) ListFileOwners(key string) ([]FileOwner, error) {
+	query := `SELECT user_id, visibility, CASE WHEN file_path = $1 THEN mime_type ELSE '' END
+			  FROM media
+			  WHERE deleted_at IS NULL AND (file_path = $1 OR poster_path = $1
+			  OR id IN (SELECT media_id FROM media_variants WHERE file_path = $1)
+			  OR id IN (SELECT media_id FROM media_renditions WHERE playlist_path = $2))
+			  UNION ALL
+			  SELECT m.user_id, 'private', v.mime_type
+			  FROM media_versions v JOIN media m ON m.id = v.media_id
+			  WHERE v.file_path = $1 AND m.deleted_at IS NULL`
+
+	playlistPath := path.Join(path.Dir(key), models.HLSPlaylistName)
+	rows, err := r.db.Query(query, key, playlistPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var owners []FileOwner
+	for rows.Next() {
+		var owner FileOwner
+		if err := rows.Scan(&owner.UserID, &owner.Visibility, &owner.MimeType); err != nil {
+			return nil, err
+		}
+		owners = append(owners, owner)
+	}
+
+	return owners, rows.Err()
+}
+
+// MarkProcessed registra que o processamento em segundo plano da mídia
+// terminou. Se o arquivo foi substituído durante o processamento (file_path
+// diferente), a mídia continua pendente e será processada de novo.
+func (r *MediaRepository) MarkProcessed(id int, filePath string) error {
+	query := `UPDATE media SET processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND file_path = $2`
+	_, err := r.db.Exec(query, id, filePath)
+	return err
+}
+
+// MarkUnprocessed faz a mídia voltar à fila de processamento, para que
+// variantes e poster sejam gerados novamente
+func (r *MediaRepository) MarkUnprocessed(id int) error {
+	_, err := r.db.Exec(`UPDATE media SET processed_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
+// StoredFile é um arquivo do armazenamento referenciado pelo banco de dados
+type StoredFile struct {
+	// Kind indica a origem da referência: original, version, variant, poster
+	// ou rendition (a playlist de uma rendição HLS)
+	Kind    string
+	MediaID int
+	Key     string
+	// Size e Checksum são nulos quando o banco não registra o valor
+	Size     *int64
+	Checksum *string
+}
+
+// ListStoredFiles lista todos os arquivos referenciados por mídias (inclusive
+// as que estão na lixeira), versões, variantes, posters e playlists HLS. Os
+// segmentos HLS não são listados: ficam no diretório da playlist.
+func (r *MediaRepository) ListStoredFiles() ([]StoredFile, error) {
+	query := `SELECT 'original', id, file_path, file_size, checksum FROM media
+			  UNION ALL
+			  SELECT 'poster', id, poster_path, NULL, NULL FROM media WHERE poster_path IS NOT NULL
+			  UNION ALL
+			  SELECT 'variant', media_id, file_path, file_size, NULL FROM media_variants
+			  UNION ALL
+			  SELECT 'version', media_id, file_path, file_size, checksum FROM media_versions
+			  UNION ALL
+			  SELECT 'rendition', media_id, playlist_path, NULL, NULL FROM media_renditions`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []StoredFile
+	for rows.Next() {
+		var file StoredFile
+		if err := rows.Scan(&file.Kind, &file.MediaID, &file.Key, &file.Size, &file.Checksum); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// MarkBroken registra que o arquivo original da mídia está ausente ou corrompido
+func (r *MediaRepository) MarkBroken(id int, reason string) error {
+	query := `UPDATE media SET broken_at = COALESCE(broken_at, CURRENT_TIMESTAMP), broken_reason = $1,
+			  updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2`
+	_, err := r.db.Exec(query, reason, id)
+	return err
+}
+
+// ClearBroken remove a marcação das mídias que não estão em keep, cujo
+// arquivo voltou a estar íntegro
+func (r *MediaRepository) ClearBroken(keep []int) (int64, error) {
+	query := `UPDATE media SET broken_at = NULL, broken_reason = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE broken_at IS NOT NULL AND NOT (id = ANY($1))`
+	if keep == nil {
+		keep = []int{}
+	}
+	result, err := r.db.Exec(query, pq.Array(keep))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateVideoInfo grava os dados extraídos de um vídeo
+func (r *MediaRepository) UpdateVideoInfo(id int, info *models.VideoInfo) error {
+	query := `UPDATE media SET duration = $1, width = $2, height = $3, video_codec = $4, poster_path = $5,
+			  updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $6`
+	_, err := r.db.Exec(query, info.Duration, info.Width, info.Height,
+		info.VideoCodec, nullIfEmpty(info.PosterPath), id)
+	return err
+}
+
+// ListUnprocessed retorna os IDs das mídias que ainda aguardam processamento
+func (r *MediaRepository) ListUnprocessed(limit int) ([]int, error) {
+	query := `SELECT id FROM media WHERE processed_at IS NULL AND deleted_at IS NULL ORDER BY id LIMIT $1`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ListVariants lista as variantes geradas para uma mídia
+func (r *MediaRepository) ListVariants(mediaID int) ([]models.MediaVariant, error) {
+	media := &models.Media{ID: mediaID}
+	if err := r.attachDetails([]*models.Media{media}); err != nil {
+		return nil, err
+	}
+	return media.Variants, nil
+}
+
+// ReplaceVariants substitui as variantes de uma mídia pelas informadas e
+// retorna as variantes anteriores, para que seus arquivos sejam removidos
+func (r *MediaRepository) ReplaceVariants(mediaID int, variants []models.MediaVariant) ([]models.MediaVariant, error) {
+	previous, err := r.ListVariants(mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM media_variants WHERE media_id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO media_variants (media_id, name, width, height, format, mime_type, file_path, file_size)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  RETURNING id, created_at`
+
+	for i := range variants {
+		variant := &variants[i]
+		variant.MediaID = mediaID
+		err := tx.QueryRow(query, mediaID, variant.Name, variant.Width, variant.Height,
+			variant.Format, variant.MimeType, variant.FilePath, variant.FileSize).Scan(
+			&variant.ID, &variant.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+// ListRenditions lista as rendições HLS geradas para um vídeo
+func (r *MediaRepository) ListRenditions(mediaID int) ([]models.MediaRendition, error) {
+	media := &models.Media{ID: mediaID}
+	if err := r.attachDetails([]*models.Media{media}); err != nil {
+		return nil, err
+	}
+	return media.Renditions, nil
+}
+
+// ReplaceRenditions substitui as rendições HLS de um vídeo pelas informadas e
+// retorna as anteriores, para que seus arquivos sejam removidos
+func (r *MediaRepository) ReplaceRenditions(mediaID int, renditions []models.MediaRendition) ([]models.MediaRendition, error) {
+	previous, err := r.ListRenditions(mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM media_renditions WHERE media_id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO media_renditions (media_id, name, width, height, bandwidth, playlist_path, file_size)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING id, created_at`
+
+	for i := range renditions {
+		rendition := &renditions[i]
+		rendition.MediaID = mediaID
+		err := tx.QueryRow(query, mediaID, rendition.Name, rendition.Width, rendition.Height,
+			rendition.Bandwidth, rendition.PlaylistPath, rendition.FileSize).Scan(
+			&rendition.ID, &rendition.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, mediaID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+// scanMediaRows lê todas as mídias do resultado e carrega suas variantes
+func (r *MediaRepository) scanMediaRows(rows *sql.Rows) ([]models.Media, error) {
+	var medias []models.Media
+	for rows.Next() {
+		var media models.Media
+		if err := scanMedia(rows, &media); err != nil {
+			return nil, err
+		}
+		medias = append(medias, media)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*models.Media, len(medias))
+	for i := range medias {
+		refs[i] = &medias[i]
+	}
+	if err := r.attachDetails(refs); err != nil {
+		return nil, err
+	}
+
+	return medias, nil
+}
+
+// attachDetails carrega, com uma consulta por relação, as variantes, rendições e tags das mídias informadas
+func (r *MediaRepository) attachDetails(medias []*models.Media) error {
+	if len(medias) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Media, len(medias))
+	ids := make([]int64, 0, len(medias))
+	for _, media := range medias {
+		media.Tags = []string{}
+		media.Variants = []models.MediaVariant{}
+		media.Renditions = []models.MediaRendition{}
+		byID[media.ID] = media
+		ids = append(ids, int64(media.ID))
+	}
+
+	if err := r.attachVariants(byID, ids); err != nil {
+		return err
+	}
+	if err := r.attachRenditions(byID, ids); err != nil {
+		return err
+	}
+	return r.attachTags(byID, ids)
+}
+
+func (r *MediaRepository) attachRenditions(byID map[int]*models.Media, ids []int64) error {
+	query := `SELECT id, media_id, name, width, height, bandwidth, playlist_path, file_size, created_at
+			  FROM media_renditions WHERE media_id = ANY($1) ORDER BY media_id, height`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rendition models.MediaRendition
+		if err := rows.Scan(
+			&rendition.ID, &rendition.MediaID, &rendition.Name, &rendition.Width, &rendition.Height,
+			&rendition.Bandwidth, &rendition.PlaylistPath, &rendition.FileSize, &rendition.CreatedAt,
+		); err != nil {
+			return err
+		}
+		if media, ok := byID[rendition.MediaID]; ok {
+			media.Renditions = append(media.Renditions, rendition)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *MediaRepository) attachVariants(byID map[int]*models.Media, ids []int64) error {
+	query := `SELECT id, media_id, name, width, height, format, mime_type, file_path, file_size, created_at
+			  FROM media_variants WHERE media_id = ANY($1) ORDER BY media_id, width`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant models.MediaVariant
+		if err := rows.Scan(
+			&variant.ID, &variant.MediaID, &variant.Name, &variant.Width, &variant.Height,
+			&variant.Format, &variant.MimeType, &variant.FilePath, &variant.FileSize, &variant.CreatedAt,
+		); err != nil {
+			return err
+		}
+		if media, ok := byID[variant.MediaID]; ok {
+			media.Variants = append(media.Variants, variant)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *MediaRepository) attachTags(byID map[int]*models.Media, ids []int64) error {
+	query := `SELECT mt.media_id, t.name FROM media_tags mt
+			  JOIN tags t ON t.id = mt.tag_id
+			  WHERE mt.media_id = ANY($1) ORDER BY mt.media_id, t.name`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaID int
+		var name string
+		if err := rows.Scan(&mediaID, &name); err != nil {
+			return err
+		}
+		if media, ok := byID[mediaID]; ok {
+			media.Tags = append(media.Tags, name)
+		}
+	}
+
+	return rows.Err()
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
 }
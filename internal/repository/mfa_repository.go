@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"multi-upload-api/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrMFALocked indica que o usuário errou códigos demais e está bloqueado
+var ErrMFALocked = errors.New("autenticação em dois fatores bloqueada temporariamente")
+
+// MFARepository guarda a configuração da autenticação em dois fatores: os
+// segredos TOTP, os códigos de recuperação, os desafios de login e os papéis
+// para os quais ela é obrigatória
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// SetPendingSecret grava um novo segredo TOTP, ainda não confirmado. Não tem
+// efeito (sql.ErrNoRows) se a autenticação em dois fatores já estiver ativa.
+func (r *MFARepository) SetPendingSecret(userID int, secret string) error {
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2 AND mfa_enabled_at IS NULL`
+	return execOne(r.db, query, secret, userID)
+}
+
+// Enable ativa a autenticação em dois fatores com o segredo já gravado,
+// registrando o período do código usado na confirmação, e substitui os
+// códigos de recuperação
+func (r *MFARepository) Enable(userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET mfa_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $1, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2 AND totp_secret IS NOT NULL AND mfa_enabled_at IS NULL`
+	if err := execOne(tx, query, step, userID); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable remove o segredo TOTP e os códigos de recuperação do usuário
+func (r *MFARepository) Disable(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_secret = NULL, totp_last_step = NULL, mfa_enabled_at = NULL,
+			  mfa_failed_attempts = 0, mfa_locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1`
+	if err := execOne(tx, query, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes troca todos os códigos de recuperação do usuário
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO mfa_recovery_codes (user_id, code_hash)
+			  SELECT $1, UNNEST($2::text[])`
+	_, err := tx.Exec(query, userID, pq.Array(codeHashes))
+	return err
+}
+
+// AttemptCode registra uma tentativa de código de dois fatores do usuário,
+// antes de o código ser conferido, e retorna ErrMFALocked durante o bloqueio.
+// A tentativa que completa maxFailures falhas seguidas ainda é conferida, mas
+// bloqueia as seguintes por lockout; passado o bloqueio, cada nova falha
+// bloqueia de novo. ResetFailures zera a contagem quando o código é aceito.
+func (r *MFARepository) AttemptCode(userID, maxFailures int, lockout time.Duration) error {
+	query := `UPDATE users SET mfa_failed_attempts = mfa_failed_attempts + 1,
+			  mfa_locked_until = CASE WHEN mfa_failed_attempts + 1 >= $2
+			                     THEN CURRENT_TIMESTAMP + $3 * INTERVAL '1 second' END
+			  WHERE id = $1 AND (mfa_locked_until IS NULL OR mfa_locked_until <= CURRENT_TIMESTAMP)`
+	err := execOne(r.db, query, userID, maxFailures, lockout.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMFALocked
+	}
+	return err
+}
+
+// ResetFailures zera as falhas de código do usuário
+func (r *MFARepository) ResetFailures(userID int) error {
+	_, err := r.db.Exec(`UPDATE users SET mfa_failed_attempts = 0, mfa_locked_until = NULL WHERE id = $1`, userID)
+	return err
+}
+
+// UseTOTPStep registra o uso do código TOTP do período step. Retorna false se
+// um código do mesmo período (ou de um posterior) já tiver sido usado.
+func (r *MFARepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1
+			  WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	return affectsOne(r.db.Exec(query, step, userID))
+}
+
+// UseRecoveryCode consome um código de recuperação. Retorna false se ele não
+// existir ou já tiver sido usado.
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	return affectsOne(r.db.Exec(query, userID, codeHash))
+}
+
+// CountRecoveryCodes conta os códigos de recuperação ainda não usados
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID).Scan(&count)
+	return count, err
+}
+
+// CreateChallenge grava o desafio da segunda etapa do login (apenas o hash)
+func (r *MFARepository) CreateChallenge(userID int, hash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		hash, userID, expiresAt)
+	return err
+}
+
+// AttemptChallenge registra uma tentativa de resposta ao desafio e retorna o
+// usuário. Retorna sql.ErrNoRows se o desafio não existir, estiver expirado
+// ou já tiver recebido maxAttempts tentativas.
+func (r *MFARepository) AttemptChallenge(hash string, maxAttempts int) (int, error) {
+	var userID int
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1
+			  WHERE token_hash = $1 AND attempts < $2 AND expires_at > CURRENT_TIMESTAMP
+			  RETURNING user_id`
+	err := r.db.QueryRow(query, hash, maxAttempts).Scan(&userID)
+	return userID, err
+}
+
+// DeleteChallenge remove um desafio já respondido
+func (r *MFARepository) DeleteChallenge(hash string) error {
+	_, err := r.db.Exec(`DELETE FROM mfa_challenges WHERE token_hash = $1`, hash)
+	return err
+}
+
+// DeleteExpiredChallenges remove os desafios vencidos
+func (r *MFARepository) DeleteExpiredChallenges() error {
+	_, err := r.db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < CURRENT_TIMESTAMP`)
+	return err
+}
+
+// RequiredRoles lista os papéis para os quais a autenticação em dois fatores
+// é obrigatória
+func (r *MFARepository) RequiredRoles() ([]models.Role, error) {
+	rows, err := r.db.Query(`SELECT role FROM mfa_required_roles ORDER BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// SetRequiredRoles substitui os papéis que exigem autenticação em dois fatores
+func (r *MFARepository) SetRequiredRoles(roles []models.Role) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_required_roles`); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec(`INSERT INTO mfa_required_roles (role) VALUES ($1) ON CONFLICT DO NOTHING`, role); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// IsRequired indica se o papel exige autenticação em dois fatores
+func (r *MFARepository) IsRequired(role models.Role) (bool, error) {
+	var required bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM mfa_required_roles WHERE role = $1)`, role).Scan(&required)
+	return required, err
+}
+
+// execer é implementado por *sql.DB e *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// execOne executa o comando e retorna sql.ErrNoRows se nenhuma linha for afetada
+func execOne(db execer, query string, args ...interface{}) error {
+	ok, err := affectsOne(db.Exec(query, args...))
+	if err == nil && !ok {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// affectsOne indica se o comando afetou alguma linha
+func affectsOne(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"multi-upload-api/internal/models"
+	"time"
+)
+
+// ErrTokenReused indica que um refresh token já rotacionado foi usado de novo.
+// Isso só acontece se o token vazou: a família inteira é revogada.
+var ErrTokenReused = errors.New("refresh token reutilizado")
+
+// ErrUserDisabled indica que o refresh token pertence a um usuário desativado
+var ErrUserDisabled = errors.New("usuário desativado")
+
+// ErrResetCooldown indica que um token de redefinição de senha foi enviado
+// ao usuário há pouco tempo
+var ErrResetCooldown = errors.New("token de redefinição enviado recentemente")
+
+type TokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// CreateRefreshToken grava um refresh token (apenas o hash)
+func (r *TokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_token_id, access_expires_at, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+
+	return r.db.QueryRow(query, token.UserID, token.FamilyID, token.TokenHash,
+		token.AccessTokenID, token.AccessExpiresAt, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+// RotateRefreshToken troca o refresh token de hash informado por next, na
+// mesma família e para o mesmo usuário (preenchidos em next, também em caso
+// de erro, se o token existir). Retorna
+// sql.ErrNoRows se o token não existir, estiver expirado ou revogado,
+// ErrUserDisabled, sem usar o token, se o usuário estiver desativado, e
+// ErrTokenReused, após revogar a família, se ele já tiver sido usado.
+func (r *TokenRepository) RotateRefreshToken(hash string, next *models.RefreshToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Bloquear o token para que duas renovações simultâneas não gerem duas
+	// famílias válidas, e o usuário para que uma desativação concorrente
+	// espere a renovação terminar (e encerre a sessão renovada)
+	current := &models.RefreshToken{}
+	var expired, disabled bool
+	query := `SELECT rt.id, rt.user_id, rt.family_id, rt.used_at, rt.revoked_at,
+			  rt.expires_at < CURRENT_TIMESTAMP, u.disabled_at IS NOT NULL
+			  FROM refresh_tokens rt JOIN users u ON u.id = rt.user_id
+			  WHERE rt.token_hash = $1
+			  FOR UPDATE OF rt FOR SHARE OF u`
+	err = tx.QueryRow(query, hash).Scan(&current.ID, &current.UserID, &current.FamilyID,
+		&current.UsedAt, &current.RevokedAt, &expired, &disabled)
+	if err != nil {
+		return err
+	}
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+
+	if disabled {
+		return ErrUserDisabled
+	}
+
+	if current.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	if current.UsedAt != nil {
+		if err := revokeFamily(tx, current.FamilyID); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrTokenReused
+	}
+	if expired {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, current.ID); err != nil {
+		return err
+	}
+
+	insert := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_token_id, access_expires_at, expires_at)
+			   VALUES ($1, $2, $3, $4, $5, $6)
+			   RETURNING id, created_at`
+	err = tx.QueryRow(insert, next.UserID, next.FamilyID, next.TokenHash,
+		next.AccessTokenID, next.AccessExpiresAt, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeSession encerra uma sessão: revoga todos os refresh tokens da família
+// e os access tokens emitidos para ela, inclusive o informado em tokenID
+func (r *TokenRepository) RevokeSession(familyID, tokenID string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeFamily(tx, familyID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2)
+			  ON CONFLICT (token_id) DO NOTHING`
+	if _, err := tx.Exec(query, tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUserSessions encerra todas as sessões de um usuário, revogando seus
+// refresh tokens e os access tokens ainda válidos
+func (r *TokenRepository) RevokeUserSessions(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO revoked_tokens (token_id, expires_at)
+			  SELECT access_token_id, access_expires_at FROM refresh_tokens
+			  WHERE user_id = $1 AND access_expires_at > CURRENT_TIMESTAMP
+			  ON CONFLICT (token_id) DO NOTHING`
+	if _, err := tx.Exec(query, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+					  WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeFamily revoga os refresh tokens de uma família e coloca na lista de
+// revogação os access tokens ainda válidos emitidos com eles
+func revokeFamily(tx *sql.Tx, familyID string) error {
+	query := `INSERT INTO revoked_tokens (token_id, expires_at)
+			  SELECT access_token_id, access_expires_at FROM refresh_tokens
+			  WHERE family_id = $1 AND access_expires_at > CURRENT_TIMESTAMP
+			  ON CONFLICT (token_id) DO NOTHING`
+	if _, err := tx.Exec(query, familyID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+					   WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	return err
+}
+
+// CreatePasswordReset grava um token de redefinição de senha (apenas o hash).
+// Tokens anteriores ainda não usados do usuário deixam de valer. Retorna
+// ErrResetCooldown, sem alterar nada, se o usuário já tiver recebido um token
+// ainda válido há menos de cooldown.
+func (r *TokenRepository) CreatePasswordReset(userID int, hash string, expiresAt time.Time, cooldown time.Duration) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A linha do usuário serializa pedidos simultâneos
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+
+	var recent bool
+	query := `SELECT EXISTS (SELECT 1 FROM password_reset_tokens
+			  WHERE user_id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			  AND created_at > CURRENT_TIMESTAMP - $2 * INTERVAL '1 second')`
+	if err := tx.QueryRow(query, userID, cooldown.Seconds()).Scan(&recent); err != nil {
+		return err
+	}
+	if recent {
+		return ErrResetCooldown
+	}
+
+	_, err = tx.Exec(`UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+					  WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(query, userID, hash, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumePasswordReset usa o token de redefinição de hash informado para
+// gravar a nova senha, na mesma transação, e retorna o ID do usuário. Retorna
+// sql.ErrNoRows se o token não existir, já tiver sido usado ou estiver expirado.
+func (r *TokenRepository) ConsumePasswordReset(hash, hashedPassword string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	query := `UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+			  WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			  RETURNING user_id`
+	if err := tx.QueryRow(query, hash).Scan(&userID); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		hashedPassword, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// IsRevoked indica se o access token de jti informado foi revogado
+func (r *TokenRepository) IsRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE token_id = $1)`, tokenID).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpired remove os refresh tokens, as revogações e os tokens de
+// redefinição de senha vencidos, que não têm mais efeito
+func (r *TokenRepository) DeleteExpired() error {
+	if _, err := r.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec(`DELETE FROM password_reset_tokens WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+	return err
+}
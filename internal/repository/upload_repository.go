@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"multi-upload-api/internal/models"
+	"time"
+)
+
+// ErrUploadFinished indica que o upload resumível já gerou uma mídia
+var ErrUploadFinished = errors.New("upload já concluído")
+
+type UploadRepository struct {
+	db *sql.DB
+}
+
+func NewUploadRepository(db *sql.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+// Create registra um novo upload resumível
+func (r *UploadRepository) Create(upload *models.Upload) error {
+	query := `INSERT INTO tus_uploads (id, user_id, upload_length, upload_offset, metadata, filename, content_type)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING created_at, updated_at`
+
+	return r.db.QueryRow(query, upload.ID, upload.UserID, upload.Length, upload.Offset,
+		upload.Metadata, upload.Filename, upload.ContentType).Scan(
+		&upload.CreatedAt, &upload.UpdatedAt,
+	)
+}
+
+// GetByID busca um upload do usuário por ID
+func (r *UploadRepository) GetByID(id string, userID int) (*models.Upload, error) {
+	query := `SELECT id, user_id, upload_length, upload_offset, metadata, filename,
+			  content_type, media_id, created_at, updated_at
+			  FROM tus_uploads WHERE id = $1 AND user_id = $2`
+
+	upload := &models.Upload{}
+	err := r.db.QueryRow(query, id, userID).Scan(
+		&upload.ID, &upload.UserID, &upload.Length, &upload.Offset, &upload.Metadata,
+		&upload.Filename, &upload.ContentType, &upload.MediaID,
+		&upload.CreatedAt, &upload.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// AdvanceOffset registra quantos bytes do upload já foram recebidos, desde
+// que o offset gravado ainda seja from. Retorna sql.ErrNoRows caso contrário.
+func (r *UploadRepository) AdvanceOffset(id string, from, to int64) error {
+	query := `UPDATE tus_uploads SET upload_offset = $1 WHERE id = $2 AND upload_offset = $3`
+	return execOne(r.db, query, to, id, from)
+}
+
+// DeleteExpired exclui os uploads sem atividade desde before e retorna seus IDs
+func (r *UploadRepository) DeleteExpired(before time.Time) ([]string, error) {
+	rows, err := r.db.Query(`DELETE FROM tus_uploads WHERE updated_at < $1 RETURNING id`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Delete exclui um upload
+func (r *UploadRepository) Delete(id string, userID int) error {
+	query := `DELETE FROM tus_uploads WHERE id = $1 AND user_id = $2`
+	_, err := r.db.Exec(query, id, userID)
+	return err
+}
@@ -2,7 +2,20 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"multi-upload-api/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrUsernameTaken indica que já existe um usuário com o nome informado
+	ErrUsernameTaken = errors.New("nome de usuário já está em uso")
+	// ErrEmailTaken indica que já existe um usuário com o e-mail informado
+	ErrEmailTaken = errors.New("e-mail já está em uso")
+	// ErrLastAdmin indica que a alteração deixaria o sistema sem nenhum
+	// administrador ativo
+	ErrLastAdmin = errors.New("último administrador ativo")
 )
 
 type UserRepository struct {
@@ -13,18 +26,25 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// GetByUsername busca usuário por username
-func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
-	query := `SELECT id, username, password, created_at, updated_at 
-			  FROM users WHERE username = $1`
+// userColumns lista as colunas lidas nas consultas de usuários, na ordem
+// esperada por scanUser
+const userColumns = `id, username, password, role, email, totp_secret, mfa_enabled_at, disabled_at, quota_bytes, quota_files, created_at, updated_at`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.Password,
+func scanUser(row rowScanner, user *models.User) error {
+	return row.Scan(
+		&user.ID, &user.Username, &user.Password, &user.Role, &user.Email,
+		&user.TOTPSecret, &user.MFAEnabledAt, &user.DisabledAt,
+		&user.QuotaBytes, &user.QuotaFiles,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
+}
 
-	if err != nil {
+// GetByUsername busca usuário por username
+func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	user := &models.User{}
+	if err := scanUser(r.db.QueryRow(query, username), user); err != nil {
 		return nil, err
 	}
 
@@ -33,29 +53,207 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 
 // GetByID busca usuário por ID
 func (r *UserRepository) GetByID(id int) (*models.User, error) {
-	query := `SELECT id, username, password, created_at, updated_at 
-			  FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
 	user := &models.User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Password,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	if err := scanUser(r.db.QueryRow(query, id), user); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	return user, nil
+}
+
+// GetByEmail busca usuário por e-mail, sem diferenciar maiúsculas
+func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+
+	user := &models.User{}
+	if err := scanUser(r.db.QueryRow(query, email), user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// Create cria um novo usuário
+// List lista todos os usuários, em ordem de nome
+func (r *UserRepository) List() ([]models.User, error) {
+	rows, err := r.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Create cria um novo usuário. Sem papel informado, o usuário é um viewer.
+// Retorna ErrUsernameTaken ou ErrEmailTaken se o nome ou o e-mail já existirem.
 func (r *UserRepository) Create(user *models.User) error {
-	query := `INSERT INTO users (username, password) 
-			  VALUES ($1, $2) 
+	if user.Role == "" {
+		user.Role = models.RoleViewer
+	}
+
+	query := `INSERT INTO users (username, password, role, email) 
+			  VALUES ($1, $2, $3, $4) 
 			  RETURNING id, created_at, updated_at`
 
-	return r.db.QueryRow(query, user.Username, user.Password).Scan(
+	err := r.db.QueryRow(query, user.Username, user.Password, user.Role, user.Email).Scan(
 		&user.ID, &user.CreatedAt, &user.UpdatedAt,
 	)
+	return usernameError(err)
+}
+
+// Update grava o nome, o papel e o e-mail do usuário. Retorna
+// ErrUsernameTaken ou ErrEmailTaken se o novo nome ou e-mail já existirem, e
+// ErrLastAdmin se o papel do último administrador ativo for alterado.
+func (r *UserRepository) Update(user *models.User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if user.Role != models.RoleAdmin {
+		if err := guardLastAdmin(tx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE users SET username = $1, role = $2, email = $3, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $4
+			  RETURNING updated_at`
+	if err := tx.QueryRow(query, user.Username, user.Role, user.Email, user.ID).Scan(&user.UpdatedAt); err != nil {
+		return usernameError(err)
+	}
+
+	return tx.Commit()
+}
+
+// usernameError converte as violações das restrições UNIQUE do username e do
+// e-mail em ErrUsernameTaken e ErrEmailTaken
+func usernameError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "users_username_key":
+			return ErrUsernameTaken
+		case "idx_users_email":
+			return ErrEmailTaken
+		}
+	}
+	return err
+}
+
+// SetPassword grava o hash de uma nova senha
+func (r *UserRepository) SetPassword(id int, hashedPassword string) error {
+	return r.execOne(`UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		hashedPassword, id)
+}
+
+// SetDisabled desativa ou reativa o usuário. Retorna ErrLastAdmin ao
+// desativar o último administrador ativo.
+func (r *UserRepository) SetDisabled(id int, disabled bool) error {
+	query := `UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+			  updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2`
+	if !disabled {
+		return r.execOne(query, disabled, id)
+	}
+
+	return r.withoutLastAdmin(id, func(tx *sql.Tx) error {
+		return execOne(tx, query, disabled, id)
+	})
+}
+
+// Delete exclui o usuário. Mídias, álbuns e sessões são excluídos em cascata.
+// Retorna ErrLastAdmin se ele for o último administrador ativo.
+func (r *UserRepository) Delete(id int) error {
+	return r.withoutLastAdmin(id, func(tx *sql.Tx) error {
+		return execOne(tx, `DELETE FROM users WHERE id = $1`, id)
+	})
+}
+
+// withoutLastAdmin executa fn, que retira o usuário id dos administradores
+// ativos, na mesma transação da verificação de guardLastAdmin
+func (r *UserRepository) withoutLastAdmin(id int, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := guardLastAdmin(tx, id); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// guardLastAdmin bloqueia os administradores ativos até o fim da transação e
+// retorna ErrLastAdmin se id for o único deles. Com o bloqueio, alterações
+// concorrentes (ex.: dois administradores se desativando ao mesmo tempo) são
+// serializadas, e a segunda só encontra os administradores que restaram.
+func guardLastAdmin(tx *sql.Tx, id int) error {
+	rows, err := tx.Query(`SELECT id FROM users WHERE role = $1 AND disabled_at IS NULL FOR UPDATE`,
+		models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count, found := 0, false
+	for rows.Next() {
+		var adminID int
+		if err := rows.Scan(&adminID); err != nil {
+			return err
+		}
+		count++
+		found = found || adminID == id
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if found && count <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// execOne executa um comando que deve afetar exatamente uma linha,
+// retornando sql.ErrNoRows caso contrário
+func (r *UserRepository) execOne(query string, args ...interface{}) error {
+	return execOne(r.db, query, args...)
+}
+
+// SetQuota define a cota do usuário. Valores nulos voltam a usar o padrão da
+// configuração.
+func (r *UserRepository) SetQuota(id int, quotaBytes *int64, quotaFiles *int) error {
+	query := `UPDATE users SET quota_bytes = $1, quota_files = $2, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $3`
+
+	result, err := r.db.Exec(query, quotaBytes, quotaFiles, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
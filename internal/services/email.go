@@ -3,8 +3,11 @@ package services
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"multi-upload-api/internal/config"
+	"net/url"
 	"strconv"
+	"time"
 
 	"gopkg.in/gomail.v2"
 )
@@ -75,3 +78,59 @@ func (e *EmailService) SendContactEmail(req *ContactRequest) error {
 	fmt.Println("[EmailService] E-mail enviado com sucesso via Zoho!")
 	return nil
 }
+
+// SendPasswordResetEmail envia ao usuário o token de redefinição de senha. Com
+// PASSWORD_RESET_URL configurada, o e-mail traz um link para a página do
+// frontend com o token no parâmetro "token".
+func (e *EmailService) SendPasswordResetEmail(to, username, token string, ttl time.Duration) error {
+	port, err := strconv.Atoi(e.config.SMTPPort)
+	if err != nil {
+		return fmt.Errorf("[EmailService] porta SMTP inválida: %v", err)
+	}
+
+	d := gomail.NewDialer(e.config.SMTPHost, port, e.config.SMTPUsername, e.config.SMTPPassword)
+	d.SSL = false // STARTTLS
+	d.TLSConfig = &tls.Config{
+		ServerName: e.config.SMTPHost,
+	}
+
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", e.config.FromEmail, e.config.FromName)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Redefinição de senha")
+
+	instructions := fmt.Sprintf(`<p>Use o código abaixo para redefinir sua senha:</p>
+            <p><strong>%s</strong></p>`, token)
+	if e.config.PasswordResetURL != "" {
+		// A URL configurada pode já ter query string (e fragmento)
+		link, err := url.Parse(e.config.PasswordResetURL)
+		if err != nil {
+			return fmt.Errorf("PASSWORD_RESET_URL inválida: %w", err)
+		}
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = fmt.Sprintf(`<p><a href="%s">Clique aqui para redefinir sua senha</a></p>`, html.EscapeString(link.String()))
+	}
+
+	body := fmt.Sprintf(`
+        <html>
+        <body>
+            <h2>Redefinição de senha</h2>
+            <p>Olá, %s.</p>
+            <p>Recebemos um pedido para redefinir a senha da sua conta.</p>
+            %s
+            <p>Ele é válido por %d minutos e pode ser usado uma única vez. Se você
+            não pediu a redefinição, ignore este e-mail: sua senha continua a mesma.</p>
+        </body>
+        </html>
+    `, html.EscapeString(username), instructions, int(ttl.Minutes()))
+
+	m.SetBody("text/html", body)
+
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("[EmailService] erro ao enviar email: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"path"
+)
+
+// BlobKey retorna a chave de um conteúdo no layout endereçado por conteúdo,
+// com dois níveis de diretório para não concentrar arquivos em uma única
+// pasta (blobs/ab/cd/abcd...)
+func BlobKey(checksum string) string {
+	return path.Join("blobs", checksum[0:2], checksum[2:4], checksum)
+}
+
+// ParseBlobKey extrai o checksum de uma chave no layout de blobs
+func ParseBlobKey(key string) (string, bool) {
+	checksum := path.Base(key)
+	if len(checksum) != 64 || BlobKey(checksum) != key {
+		return "", false
+	}
+	return checksum, true
+}
+
+// DigestReader conta os bytes lidos e calcula o SHA-256 do conteúdo à medida
+// que ele é consumido, sem precisar de uma segunda leitura do arquivo
+type DigestReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func NewDigestReader(r io.Reader) *DigestReader {
+	return &DigestReader{r: r, hash: sha256.New()}
+}
+
+func (d *DigestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if n > 0 {
+		d.hash.Write(p[:n])
+		d.size += int64(n)
+	}
+	return n, err
+}
+
+// Size retorna o total de bytes lidos até o momento
+func (d *DigestReader) Size() int64 {
+	return d.size
+}
+
+// SHA256 retorna o digest em hexadecimal dos bytes lidos até o momento
+func (d *DigestReader) SHA256() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
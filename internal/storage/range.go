@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// RangeReader expõe um objeto do armazenamento como io.ReadSeeker, para uso
+// com http.ServeContent em qualquer backend. O conteúdo é aberto sob demanda
+// com GetRange a partir da posição atual, e cada Seek para outra posição
+// descarta a leitura em andamento; assim uma requisição Range lê apenas o
+// trecho pedido, sem baixar o objeto inteiro.
+type RangeReader struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// NewRangeReader cria um leitor para o objeto key, cujo tamanho (obtido com
+// Stat) é size
+func NewRangeReader(ctx context.Context, backend Backend, key string, size int64) *RangeReader {
+	return &RangeReader{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, _, err := r.backend.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("posição inválida")
+	}
+
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close encerra a leitura em andamento, se houver
+func (r *RangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
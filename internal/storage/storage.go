@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"multi-upload-api/internal/config"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound é retornado quando o objeto solicitado não existe no backend
+var ErrNotFound = errors.New("objeto não encontrado")
+
+// ObjectInfo descreve um objeto armazenado
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Backend abstrai o local onde os arquivos de mídia são armazenados.
+// As chaves usam sempre "/" como separador, independente do driver.
+type Backend interface {
+	// Put grava o conteúdo de r na chave informada. size pode ser -1 quando
+	// o tamanho não é conhecido antecipadamente.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get abre o objeto para leitura. O chamador deve fechar o reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// GetRange abre o objeto para leitura a partir de offset, com no máximo
+	// length bytes (-1 lê até o fim). ObjectInfo descreve o objeto inteiro.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error)
+	// Delete remove o objeto. Remover um objeto inexistente não é erro.
+	Delete(ctx context.Context, key string) error
+	// Stat retorna os metadados do objeto sem ler seu conteúdo
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List retorna todos os objetos cuja chave começa com prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Move renomeia o objeto src para dst, substituindo dst se já existir
+	Move(ctx context.Context, src, dst string) error
+}
+
+// New cria o backend configurado em cfg.StorageDriver
+func New(cfg *config.Config) (Backend, error) {
+	switch strings.ToLower(cfg.StorageDriver) {
+	case "", "local":
+		return NewLocal(cfg.UploadPath)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:     cfg.S3Endpoint,
+			Region:       cfg.S3Region,
+			Bucket:       cfg.S3Bucket,
+			AccessKey:    cfg.S3AccessKey,
+			SecretKey:    cfg.S3SecretKey,
+			UsePathStyle: cfg.S3UsePathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("driver de armazenamento desconhecido: %s", cfg.StorageDriver)
+	}
+}
+
+// DeletePrefix remove todos os objetos cuja chave começa com prefix
+func DeletePrefix(ctx context.Context, backend Backend, prefix string) error {
+	objects, err := backend.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := backend.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanKey normaliza uma chave e impede que ela escape da raiz do backend
+func CleanKey(key string) string {
+	key = strings.ReplaceAll(key, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
@@ -2,18 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"multi-upload-api/internal/api"
 	"multi-upload-api/internal/config"
 	"multi-upload-api/internal/database"
+	"multi-upload-api/internal/integrity"
 	"multi-upload-api/internal/middleware"
 	"multi-upload-api/internal/models"
 	"multi-upload-api/internal/repository"
+	"multi-upload-api/internal/storage"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -37,11 +43,32 @@ func main() {
 		return
 	}
 
+	// Verificar se é comando de cota de usuário
+	if len(os.Args) > 1 && os.Args[1] == "set-quota" {
+		setQuotaCommand(os.Args[2:])
+		return
+	}
+
+	// Verificar se é comando de verificação do armazenamento
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		fsckCommand(os.Args[2:])
+		return
+	}
+
+	// Verificar se é comando de migrations
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(os.Args[2:])
+		return
+	}
+
 	// Carregar variáveis de ambiente (opcional, prioriza variáveis do sistema)
 	loadOptionalEnvFiles("config.env", ".env")
 
 	// Configurar aplicação
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Configuração inválida: %v", err)
+	}
 
 	// Conectar ao banco de dados
 	db, err := database.Connect(cfg.DatabaseURL())
@@ -60,6 +87,12 @@ func main() {
 		log.Fatalf("Erro ao criar diretório de uploads: %v", err)
 	}
 
+	// Inicializar armazenamento de arquivos
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Erro ao configurar armazenamento: %v", err)
+	}
+
 	// Configurar Gin
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -67,16 +100,13 @@ func main() {
 
 	router := gin.Default()
 
-	// Configurar limite de upload para arquivos grandes (1GB)
-	router.MaxMultipartMemory = 1024 << 20 // 1GB
-
 	// Middleware global
 	router.Use(middleware.CORS())
 	router.Use(middleware.RequestLogger())
 	router.Use(middleware.ErrorHandler())
 
 	// Configurar rotas
-	api.SetupRoutes(router, db, cfg)
+	api.SetupRoutes(router, db, cfg, store)
 
 	// Iniciar servidor
 	log.Printf("Servidor iniciando na porta %s", cfg.Port)
@@ -85,6 +115,223 @@ func main() {
 	}
 }
 
+func migrateCommand(args []string) {
+	usage := "Uso: migrate up | down [N] | status | to <versão>"
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	// Carregar variáveis de ambiente (opcional, prioriza variáveis do sistema)
+	loadOptionalEnvFiles("config.env", ".env")
+
+	// Configurar aplicação
+	cfg := config.Load()
+
+	// Conectar ao banco de dados
+	db, err := database.Connect(cfg.DatabaseURL())
+	if err != nil {
+		log.Fatalf("Erro ao conectar com o banco de dados: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Erro ao carregar migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	var changed []database.Migration
+
+	switch args[0] {
+	case "up":
+		changed, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("Quantidade inválida: %s", args[1])
+			}
+		}
+		changed, err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			log.Fatal(usage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			log.Fatalf("Versão inválida: %s", args[1])
+		}
+		changed, err = migrator.To(ctx, version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Erro ao consultar migrations: %v", err)
+		}
+		for _, item := range status {
+			state := "pendente"
+			if item.Applied {
+				state = "aplicada em " + item.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", item.Version, item.Name, state)
+		}
+		return
+	default:
+		log.Fatal(usage)
+	}
+
+	for _, migration := range changed {
+		fmt.Printf("✅ %04d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		log.Fatalf("Erro ao executar migrations: %v", err)
+	}
+	if len(changed) == 0 {
+		fmt.Println("Nenhuma migration a executar.")
+	}
+}
+
+func fsckCommand(args []string) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fix := flags.String("fix", "", "corrigir problemas: quarantine (move órfãos para a quarentena), mark (marca registros quebrados) ou all")
+	checksums := flags.Bool("checksums", false, "ler o conteúdo e conferir o SHA-256 dos arquivos")
+	grace := flags.Duration("grace", time.Hour, "ignorar arquivos sem referência mais novos que este período")
+	flags.Parse(args)
+
+	quarantine := *fix == "quarantine" || *fix == "all"
+	mark := *fix == "mark" || *fix == "all"
+	if *fix != "" && !quarantine && !mark {
+		log.Fatalf("Modo de correção inválido: %s (use quarantine, mark ou all)", *fix)
+	}
+
+	// Carregar variáveis de ambiente (opcional, prioriza variáveis do sistema)
+	loadOptionalEnvFiles("config.env", ".env")
+
+	// Configurar aplicação
+	cfg := config.Load()
+
+	// Conectar ao banco de dados
+	db, err := database.Connect(cfg.DatabaseURL())
+	if err != nil {
+		log.Fatalf("Erro ao conectar com o banco de dados: %v", err)
+	}
+	defer db.Close()
+
+	// Executar migrations
+	if err := database.RunMigrations(cfg.DatabaseURL()); err != nil {
+		log.Fatalf("Erro ao executar migrations: %v", err)
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Erro ao configurar armazenamento: %v", err)
+	}
+
+	checker := integrity.NewChecker(store, repository.NewMediaRepository(db), repository.NewBlobRepository(db))
+	ctx := context.Background()
+
+	report, err := checker.Check(ctx, integrity.Options{VerifyChecksums: *checksums, GracePeriod: *grace})
+	if err != nil {
+		log.Fatalf("Erro ao verificar armazenamento: %v", err)
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("\n%d referência(s) no banco, %d arquivo(s) no armazenamento, %d problema(s)\n",
+		report.Files, report.Objects, len(report.Problems))
+
+	if mark {
+		fixed, err := checker.MarkBroken(ctx, report)
+		if err != nil {
+			log.Fatalf("Erro ao marcar registros: %v", err)
+		}
+		fmt.Printf("✅ %d registro(s) atualizado(s)\n", fixed)
+	}
+	if quarantine {
+		moved, err := checker.Quarantine(ctx, report)
+		if err != nil {
+			log.Fatalf("Erro ao mover arquivos órfãos: %v", err)
+		}
+		fmt.Printf("✅ %d arquivo(s) movido(s) para %s/\n", moved, integrity.QuarantinePrefix)
+	}
+
+	if len(report.Problems) > 0 && *fix == "" {
+		os.Exit(1)
+	}
+}
+
+func setQuotaCommand(args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		log.Fatal("Uso: set-quota <usuário> <bytes|default> [arquivos|default] (ex.: set-quota maria 10GB 5000; 0 é sem limite)")
+	}
+
+	var quotaBytes *int64
+	if args[1] != "default" {
+		size, err := config.ParseSize(args[1])
+		if err != nil {
+			log.Fatalf("Cota de bytes inválida: %s", args[1])
+		}
+		quotaBytes = &size
+	}
+
+	var quotaFiles *int
+	if len(args) > 2 && args[2] != "default" {
+		files, err := strconv.Atoi(args[2])
+		if err != nil || files < 0 {
+			log.Fatalf("Cota de arquivos inválida: %s", args[2])
+		}
+		quotaFiles = &files
+	}
+
+	// Carregar variáveis de ambiente (opcional, prioriza variáveis do sistema)
+	loadOptionalEnvFiles("config.env", ".env")
+
+	// Configurar aplicação
+	cfg := config.Load()
+
+	// Conectar ao banco de dados
+	db, err := database.Connect(cfg.DatabaseURL())
+	if err != nil {
+		log.Fatalf("Erro ao conectar com o banco de dados: %v", err)
+	}
+	defer db.Close()
+
+	// Executar migrations
+	if err := database.RunMigrations(cfg.DatabaseURL()); err != nil {
+		log.Fatalf("Erro ao executar migrations: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	user, err := userRepo.GetByUsername(args[0])
+	if err != nil {
+		log.Fatalf("Usuário '%s' não encontrado", args[0])
+	}
+	if len(args) < 3 {
+		// Sem o terceiro argumento a cota de arquivos é mantida
+		quotaFiles = user.QuotaFiles
+	}
+
+	if err := userRepo.SetQuota(user.ID, quotaBytes, quotaFiles); err != nil {
+		log.Fatalf("Erro ao atualizar cota: %v", err)
+	}
+
+	fmt.Printf("✅ Cota do usuário '%s' atualizada\n", user.Username)
+	fmt.Printf("Bytes: %s\n", quotaLabel(quotaBytes))
+	fmt.Printf("Arquivos: %s\n", quotaLabel(quotaFiles))
+}
+
+// quotaLabel descreve um valor de cota para exibição
+func quotaLabel[T int | int64](value *T) string {
+	switch {
+	case value == nil:
+		return "padrão da configuração"
+	case *value == 0:
+		return "sem limite"
+	default:
+		return fmt.Sprint(*value)
+	}
+}
+
 func createUserCommand() {
 	fmt.Println("=== Script de Criação de Usuário ===")
 
@@ -163,9 +410,31 @@ func createUserCommand() {
 		log.Fatal("Senhas não coincidem")
 	}
 
+	// Papel do novo usuário (o primeiro usuário costuma ser o administrador)
+	role := models.RoleAdmin
+	var email *string
+	if existingUser == nil {
+		fmt.Print("Papel (admin/editor/viewer) [admin]: ")
+		response, _ := reader.ReadString('\n')
+		if response = strings.TrimSpace(strings.ToLower(response)); response != "" {
+			role = models.Role(response)
+		}
+		if !role.Valid() {
+			log.Fatalf("Papel inválido: %s", role)
+		}
+
+		fmt.Print("E-mail para recuperação de senha (opcional): ")
+		response, _ = reader.ReadString('\n')
+		if response = strings.TrimSpace(strings.ToLower(response)); response != "" {
+			email = &response
+		}
+	}
+
 	// Criar usuário
 	user := &models.User{
 		Username: username,
+		Role:     role,
+		Email:    email,
 	}
 
 	if err := user.HashPassword(password); err != nil {
@@ -191,6 +460,9 @@ func createUserCommand() {
 	fmt.Println("\n=== Informações do Usuário ===")
 	fmt.Printf("ID: %d\n", user.ID)
 	fmt.Printf("Username: %s\n", user.Username)
+	if existingUser == nil {
+		fmt.Printf("Papel: %s\n", user.Role)
+	}
 	fmt.Printf("Criado em: %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
 
 	fmt.Println("\n🔑 Use estas credenciais para fazer login na API:")
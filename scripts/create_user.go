@@ -105,9 +105,10 @@ func main() {
 		log.Fatal("Senhas não coincidem")
 	}
 
-	// Criar usuário
+	// Criar usuário (o usuário padrão é administrador)
 	user := &models.User{
 		Username: username,
+		Role:     models.RoleAdmin,
 	}
 
 	if err := user.HashPassword(password); err != nil {